@@ -0,0 +1,29 @@
+package main
+
+import (
+	"testing"
+
+	"uk.ac.bris.cs/gameoflife/util"
+)
+
+// TestBoundary tests Conway's Life with dead, Klein bottle and mirror edges (see checkRules), so the halo rows past the edges are checked too
+func TestBoundary(t *testing.T) {
+	checkRules(t, []ruleTest{
+		{name: "dead", check: "check/boundary/dead", boundary: "dead"},
+		{name: "klein", check: "check/boundary/klein", boundary: "klein"},
+		{name: "mirror", check: "check/boundary/mirror", boundary: "mirror"},
+	})
+}
+
+// TestParseBoundary checks boundaries are read by name, with the empty string meaning a torus
+func TestParseBoundary(t *testing.T) {
+	for boundary, expected := range map[string]util.Boundary{"": util.Torus, "torus": util.Torus, "dead": util.Dead, "klein": util.Klein, "mirror": util.Mirror} {
+		parsed, err := util.ParseBoundary(boundary)
+		if err != nil || parsed != expected {
+			t.Errorf("ParseBoundary(%q) = %v, %v, expected %v", boundary, parsed, err, expected)
+		}
+	}
+	if _, err := util.ParseBoundary("sphere"); err == nil {
+		t.Errorf("ParseBoundary(%q) should have failed", "sphere")
+	}
+}
@@ -2,10 +2,15 @@ package main
 
 import (
 	"flag"
+	"fmt"
+	"log"
 	"net"
 	"net/rpc"
+	"os"
 	"sync"
 	"time"
+	"uk.ac.bris.cs/gameoflife/hashlife"
+	"uk.ac.bris.cs/gameoflife/kernel"
 	"uk.ac.bris.cs/gameoflife/stubs"
 	"uk.ac.bris.cs/gameoflife/util"
 )
@@ -16,216 +21,341 @@ type BrokerOperations struct{}
 var completedTurns int
 var numAliveCells int
 var aliveCells []util.Cell
-var currentWorld [][]byte
-var terminate bool = false
+var currentWorld util.BitBoard
 var paused bool = false
-var terminateTurns int
+var targetTurn int
 var killBroker bool = false
 
-// tells the program how big to make the slices containing the information related to each server
-var numberOfServers = 4
-var servers = make([]*rpc.Client, numberOfServers)
-
-var ips = []string{
-	"127.0.0.1:8031",
-	"127.0.0.1:8032",
-	"127.0.0.1:8033",
-	"127.0.0.1:8034",
+// session is a client's session, or one recovered from a checkpoint. terminate is set by the q and k keys of its own client,
+// or when a client takes over from a recovered session, and it stops at its next turn boundary
+type session struct {
+	//the Session of the client's requests. a recovered session has no client
+	id        int64
+	recovered bool
+	terminate bool
 }
 
+// the session being run, and the clients' sessions waiting for it to stop. both are guarded by mutex
+var running *session
+var waiting = make(map[int64]*session)
+
+// the addresses of the GolOperations servers, loaded at start up. the slices containing the information related to each server are sized from this
+var ips []string
+var servers []*rpc.Client
+var serverAddresses []string
+
+// whether servers join and leave the pool by registering themselves. otherwise the pool is fixed at start up,
+// and a server that can't be reached or fails is kept in it and redialled in the background until it is back
+var dynamicWorkers bool
+
+// the engine used when the client doesn't ask for one. see runStitch, runP2P and runHashLife
+var defaultEngine string
+
+// whether servers are sent just their slice plus halo rows (CalculateNextSlice) rather than the whole world (CalculateNextState)
+var haloExchange bool
+
+// how long the broker waits for a server to process its slice before treating it as failed
+var workerTimeout time.Duration
+
 var mutex sync.Mutex
 var endCurrentStateChan = make(chan bool)
 
 var currentAliveCellCount int
 var currentAliveCells []util.Cell
 
+// stateUpdate is sent to the global state store after each turn, or batch of turns, is completed.
+// the peer-to-peer engine leaves the world out until the end of the run (see currentState)
+type stateUpdate struct {
+	turns         int
+	numAliveCells int
+	aliveCells    []util.Cell
+	world         util.BitBoard
+}
+
 // goroutine holds the current state of the game (no. of alive cells, no. of completed turns, current world etc.)
-func holdCurrentState(updateState chan bool, updateStateTurns chan int, updateNumAliveCells chan int, updateAliveCells chan []util.Cell, updateStateWorld chan [][]byte) {
+func holdCurrentState(updateState chan stateUpdate) {
 	for {
 		select {
 		case <-endCurrentStateChan:
 			return
-		case <-updateState:
+		case update := <-updateState:
 			mutex.Lock()
-			numAliveCells = <-updateNumAliveCells
-			aliveCells = <-updateAliveCells
-			completedTurns = <-updateStateTurns
-			currentWorld = <-updateStateWorld
+			numAliveCells = update.numAliveCells
+			aliveCells = update.aliveCells
+			completedTurns = update.turns
+			currentWorld = update.world
 			mutex.Unlock()
 
 		}
 	}
 }
 
+// startTurns is called before the broker processes a turn, or a batch of turns, ending at turn target.
+// q and s still work while the game is paused, so this waits until the game is un-paused and returns false if the client has asked to terminate
+func startTurns(target int) bool {
+	for {
+		mutex.Lock()
+		if running.terminate {
+			mutex.Unlock()
+			return false
+		}
+		if !paused {
+			//pausing from now on will take effect once the broker reaches target
+			targetTurn = target
+			mutex.Unlock()
+			return true
+		}
+		mutex.Unlock()
+		time.Sleep(time.Millisecond)
+	}
+}
+
 func (b *BrokerOperations) Broker(req stubs.Request, res *stubs.Response) (err error) {
-	//sets the game to be un-paused and not terminating on initialisation
-	//to allow new clients to join server and one leaves
-	terminate = false
+	s := &session{id: req.Session}
+	mutex.Lock()
+	waiting[s.id] = s
+	//a client starting a session takes over from one recovered from a checkpoint, which stops at its next turn boundary
+	if running != nil && running.recovered {
+		running.terminate = true
+	}
+	mutex.Unlock()
+
+	beginSession(s)
+	return runSession(req, res)
+}
+
+// beginSession waits for the session before it to stop, then gets the broker ready for the next one, s, which runSession runs
+func beginSession(s *session) {
+	sessionMutex.Lock()
+
+	//sets the game to be un-paused on initialisation
+	//to allow new clients to join server and one leaves. s may already be terminating, if its client quit while it was waiting
+	mutex.Lock()
+	if waiting[s.id] == s {
+		delete(waiting, s.id)
+	}
+	running = s
 	paused = false
 	killBroker = false
+	mutex.Unlock()
+}
 
-	//slices to hold the server requests, server responses and the server RPC connections
-	serverRequests := make([]*stubs.ServerRequest, numberOfServers)
-	serverResponses := make([]*stubs.ServerResponse, numberOfServers)
-	servers = make([]*rpc.Client, numberOfServers)
+// clientSession is the session of a client's requests, whether it is running or waiting to, or nil if it is neither.
+// mutex has to be held
+func clientSession(id int64) *session {
+	if running != nil && !running.recovered && running.id == id {
+		return running
+	}
+	return waiting[id]
+}
 
-	//channels to update the global state store
-	updateState := make(chan bool)
-	updateStateTurns := make(chan int)
-	updateAliveCells := make(chan []util.Cell)
-	updateNumAliveCells := make(chan int)
-	updateStateWorld := make(chan [][]byte)
+// runSession runs all the turns of a session begun with beginSession, for a client or recovered from a checkpoint. only one session runs at a time
+func runSession(req stubs.Request, res *stubs.Response) (err error) {
+	defer func() {
+		mutex.Lock()
+		running = nil
+		mutex.Unlock()
+		sessionMutex.Unlock()
+	}()
 
-	//starts the global state store goroutine
-	go holdCurrentState(updateState, updateStateTurns, updateNumAliveCells, updateAliveCells, updateStateWorld)
+	engine := req.Engine
+	if engine == "" {
+		engine = defaultEngine
+	}
+	if engine != "stitch" && engine != "p2p" && engine != "hashlife" {
+		return fmt.Errorf("unknown engine %q", engine)
+	}
+	//the rule and boundary are checked here, so the engines and servers can take them as read
+	rule, err := kernel.ParseRule(req.Rule)
+	if err != nil {
+		return
+	}
+	boundary, err := util.ParseBoundary(req.Boundary)
+	if err != nil {
+		return
+	}
+	if req.Neighbourhood != "" {
+		var neighbourhood kernel.Neighbourhood
+		if neighbourhood, err = kernel.ParseNeighbourhood(req.Neighbourhood); err != nil {
+			return
+		}
+		if rule, err = rule.WithNeighbourhood(neighbourhood); err != nil {
+			return
+		}
+	}
+	//odd and even rows of a hexagonal grid are shifted differently, so the rows past an edge have to line up with the rows they stand in for
+	if rule.Neighbourhood == kernel.Hex && !(boundary == util.Dead || boundary == util.Torus && req.ImageHeight%2 == 0) {
+		return fmt.Errorf("the hex neighbourhood needs a dead boundary, or a torus with an even height")
+	}
+	if engine == "hashlife" && !hashlife.Supported(req.World.Width, req.World.Height, rule, boundary) {
+		return fmt.Errorf("HashLife needs a square torus world with a power of two side and a two state rule counting the 8 cells around")
+	}
+	//sending the whole world to the servers only works a turn at a time, so the stitch engine can't take more than one turn per batch without halo exchange
+	if !haloExchange && engine == "stitch" && req.TurnsPerBatch > 1 {
+		return fmt.Errorf("the broker sends the whole world to the servers (-halo=false), so can only process one turn per batch, not %v", req.TurnsPerBatch)
+	}
+	//the neighbourhood travels to the servers as part of the rule
+	req.Rule = rule.String()
+	req.Engine = engine
+
+	//channel to update the global state store
+	updateState := make(chan stateUpdate)
 
-	ImageHeight := req.ImageHeight
-	ImageWidth := req.ImageWidth
+	//starts the global state store goroutine
+	go holdCurrentState(updateState)
 
 	//copies the inital world
-	world := make([][]byte, ImageHeight)
-	for i := range world {
-		world[i] = make([]byte, ImageWidth)
-		copy(world[i], req.World[i])
+	world := req.World.Copy()
+
+	//calculates the initial number of alive cells
+	currentAliveCells = world.AliveCells()
+	currentAliveCellCount = len(currentAliveCells)
+
+	//send the initial state down the channel
+	updateState <- stateUpdate{turns: req.StartTurn, numAliveCells: currentAliveCellCount, aliveCells: currentAliveCells, world: world}
+
+	//the session is written to a checkpoint every checkpointEvery, if the broker has somewhere to write them
+	stopCheckpoints := saveCheckpoints(req)
+
+	var turn int
+	if engine == "p2p" {
+		turn, err = runP2P(world, req, updateState)
+	} else if engine == "hashlife" {
+		turn = runHashLife(world, req, updateState)
+	} else {
+		turn = runStitch(world, req, updateState)
 	}
-	Turns := req.Turns
+	//as before the engines, a pause during the final turn holds the game until it is un-paused
+	startTurns(turn)
+	//this will cause the holdCurrentState goroutine to stop
+	endCurrentStateChan <- true
+	//the global state store has the final world, so it no longer has to be gathered from the servers
+	engineMutex.Lock()
+	p2p = nil
+	engineMutex.Unlock()
 
-	//repeats the number of times as there are servers. creates a new connection, a unique server request and an empty server response
-	for i, _ := range servers {
-		servers[i], _ = rpc.Dial("tcp", ips[i])
-		serverReq := new(stubs.ServerRequest)
-		*serverReq = stubs.ServerRequest{
-			World:        append(make([][]byte, 0), world...),
-			ImageWidth:   ImageWidth,
-			ImageHeight:  ImageHeight,
-			NoOfServers:  numberOfServers,
-			ServerNumber: i,
-		}
-		serverRequests[i] = serverReq
-		serverResponses[i] = new(stubs.ServerResponse)
+	mutex.Lock()
+	res.TerminateTurns = turn
+	res.World = currentWorld
+	res.AliveCells = aliveCells
+	takenOver := running.recovered && running.terminate
+	mutex.Unlock()
+
+	//a recovered session that a client has taken over from is kept to one side, rather than being written over by the client's session
+	stopCheckpoints()
+	if takenOver {
+		writeCheckpoint(recoveredCheckpoint, req, res.World, turn)
+	} else {
+		writeCheckpoint(sessionCheckpoint, req, res.World, turn)
 	}
 
-	//calculates the initial number of alive cells
-	currentAliveCells = calculateAliveCells(ImageHeight, ImageWidth, world)
-	currentAliveCellCount = len(currentAliveCells)
+	return
+}
+
+// runStitch is the default engine. every batch of turns, each server is sent its slice of the world and the broker stitches the results back together.
+// a batch is one turn unless the client asks for more, in which case each server is sent a halo as deep as the batch.
+// it returns the number of turns completed before finishing or being asked to terminate
+func runStitch(world util.BitBoard, req stubs.Request, updateState chan stateUpdate) int {
+	ImageHeight := world.Height
+	ImageWidth := world.Width
+	Turns := req.Turns
+	TurnsPerBatch := req.TurnsPerBatch
+	if TurnsPerBatch < 1 {
+		TurnsPerBatch = 1
+	}
+
+	//slices to hold the server requests, server responses and the server RPC connections
+	//these are sized from the worker pool, and rebuilt whenever a worker registers or deregisters
+	var numberOfServers int
+	var serverRequests []*stubs.ServerRequest
+	var serverResponses []*stubs.ServerResponse
+	workersSeen := -1
+
+	//repeat this for the number of turns specified in input params, a batch at a time, carrying on from the turn the world is on
+	count := req.StartTurn
+	for count < Turns {
+		turns := TurnsPerBatch
+		if Turns-count < turns {
+			turns = Turns - count
+		}
+		if !startTurns(count + turns) {
+			break
+		}
 
-	//send the initial state down the respective channels
-	updateState <- true
-	updateNumAliveCells <- currentAliveCellCount
-	updateAliveCells <- currentAliveCells
-	updateStateTurns <- 0
-	updateStateWorld <- world
+		//at the turn boundary, rebalance the rows across whichever workers are currently registered,
+		//or when servers in a fixed pool that were unreachable have been redialled
+		if workersChanged(workersSeen) {
+			var addresses []string
+			addresses, workersSeen = currentWorkers()
+			connectServers(addresses)
+			//with no workers in the pool, the broker processes the whole world itself as a single slice
+			if len(servers) == 0 {
+				servers = []*rpc.Client{nil}
+			}
+			numberOfServers = len(servers)
+			serverRequests = make([]*stubs.ServerRequest, numberOfServers)
+			serverResponses = make([]*stubs.ServerResponse, numberOfServers)
+
+			//repeats the number of times as there are servers. creates a unique server request and an empty server response
+			for i := range servers {
+				serverReq := new(stubs.ServerRequest)
+				*serverReq = stubs.ServerRequest{
+					World:        world,
+					ImageWidth:   ImageWidth,
+					ImageHeight:  ImageHeight,
+					NoOfServers:  numberOfServers,
+					ServerNumber: i,
+					Rule:         req.Rule,
+					Boundary:     req.Boundary,
+				}
+				serverRequests[i] = serverReq
+				serverResponses[i] = new(stubs.ServerResponse)
+			}
+		}
 
-	//repeat this for the number of turns specified in input params
-	for count := 0; count < Turns; count++ {
 		//make a slice to hold all the rpc call pointers. this is done for syncing reasons, e.g., we want to put together the sections of world in order, and only when they're done should we do this
 		doneProcessing := make([]*rpc.Call, numberOfServers)
 		for i, server := range servers {
 			//make a non-blocking rpc call to each server to process their section of GOL
-			doneProcessing[i] = server.Go(stubs.CalculateNextState, serverRequests[i], serverResponses[i], nil)
+			if server != nil {
+				doneProcessing[i] = callSlice(server, serverRequests[i], serverResponses[i], turns)
+			}
 		}
 
-		//create an empty 2d slice to eventually hold the new full world (advanced by one turn)
-		connWorld := make([][]byte, ImageHeight)
-		for i, response := range serverResponses {
+		//create an empty 2d slice to eventually hold the new full world (advanced by one batch)
+		connWorld := world.WithRows(make([][]uint64, ImageHeight))
+		for i := range serverResponses {
 			//we need to add the slices back in order, so we wait until the first one is done, then the second one, etc...
-			synced := false
-			for {
-				//if there's a value in the Call's Done channel, then the rpc call has finished, and we can safely add the slices to connWorld
-				select {
-				case <-doneProcessing[i].Done:
-					synced = true
-					break
-				}
-				if synced {
-					break
-				}
+			//if a server has failed or timed out, it is dropped from the pool and its slice is redone on a surviving server, or locally
+			if !awaitCallWithin(doneProcessing[i], workerTimeout*time.Duration(turns)) {
+				dropServer(i)
+				serverResponses[i] = recalculateSlice(serverRequests[i], turns)
 			}
 
 			//adds the results slice by slice to connWorld
 			//for each server, it will start putting in slices at the 'startIndex' and end when there's nothing left to put in
-			for j, row := range response.World {
-				connWorld[i*(ImageHeight/numberOfServers)+j] = make([]byte, ImageWidth)
-				copy(connWorld[i*(ImageHeight/numberOfServers)+j], row)
+			startIndex, _ := stubs.SliceBounds(ImageHeight, numberOfServers, i)
+			for j, row := range serverResponses[i].World.Rows {
+				connWorld.Rows[startIndex+j] = make([]uint64, len(row))
+				copy(connWorld.Rows[startIndex+j], row)
 			}
 		}
 
 		//since we use the same serverRequest structs for each turn, we need to update their version of the current world
 		for _, request := range serverRequests {
-			copy(request.World, connWorld)
+			request.World = connWorld
 		}
+		world = connWorld
+		count += turns
 
-		currentAliveCells = calculateAliveCells(ImageHeight, ImageWidth, connWorld)
+		currentAliveCells = connWorld.AliveCells()
 		currentAliveCellCount = len(currentAliveCells)
 
-		// send the current state down the respective channels
-		updateState <- true
-		updateNumAliveCells <- currentAliveCellCount
-		updateAliveCells <- currentAliveCells
-		updateStateTurns <- count + 1
-		updateStateWorld <- connWorld
-
-		for {
-			mutex.Lock()
-			if !paused {
-				mutex.Unlock()
-				break
-			}
-			mutex.Unlock()
-
-			// q and s still work even while the game is paused
-			mutex.Lock()
-			if terminate {
-				terminateTurns = count + 1
-				mutex.Unlock()
-				break
-			}
-			mutex.Unlock()
-		}
-
-		mutex.Lock()
-		if terminate {
-			terminateTurns = count + 1
-			mutex.Unlock()
-			break
-		}
-		mutex.Unlock()
-
+		// send the current state down the channel. CompletedTurns only moves on at the end of each batch
+		updateState <- stateUpdate{turns: count, numAliveCells: currentAliveCellCount, aliveCells: currentAliveCells, world: connWorld}
 	}
 
-	//this will cause the holdCurrentState goroutine to stop
-	endCurrentStateChan <- true
-
-	mutex.Lock()
-	if !terminate {
-		res.TerminateTurns = Turns
-	} else {
-		res.TerminateTurns = terminateTurns
-	}
-	mutex.Unlock()
-
-	mutex.Lock()
-	res.World = currentWorld
-	res.AliveCells = aliveCells
-
-	mutex.Unlock()
-
-	return
-}
-
-func calculateAliveCells(ImageHeight, ImageWidth int, world [][]byte) []util.Cell {
-
-	liveCells := []util.Cell{}
-
-	for i := 0; i < ImageHeight; i++ {
-		for j := 0; j < ImageWidth; j++ {
-			if world[i][j] == 255 {
-				liveCells = append(liveCells, util.Cell{X: j, Y: i})
-			}
-		}
-	}
-
-	return liveCells
+	return count
 }
 
 func (b *BrokerOperations) ReturnAliveCells(req stubs.Request, res *stubs.Response) (err error) {
@@ -239,13 +369,22 @@ func (b *BrokerOperations) ReturnAliveCells(req stubs.Request, res *stubs.Respon
 }
 
 func (b *BrokerOperations) SaveCurrentState(req stubs.Request, res *stubs.Response) (err error) {
+	res.World, res.CompletedTurns, err = currentState()
+	return
+}
 
-	mutex.Lock()
-	res.CompletedTurns = completedTurns
-	res.World = currentWorld
-	mutex.Unlock()
+// currentState is the current world and the turn it is on. the peer-to-peer engine doesn't keep the world on the broker, so it is gathered from the servers
+func currentState() (util.BitBoard, int, error) {
+	engineMutex.Lock()
+	defer engineMutex.Unlock()
+	if p2p != nil {
+		world, err := p2p.collect()
+		return world, p2p.worldTurn, err
+	}
 
-	return
+	mutex.Lock()
+	defer mutex.Unlock()
+	return currentWorld, completedTurns, nil
 }
 
 func (b *BrokerOperations) PauseProcessingToggle(req stubs.Request, res *stubs.Response) (err error) {
@@ -253,8 +392,8 @@ func (b *BrokerOperations) PauseProcessingToggle(req stubs.Request, res *stubs.R
 	mutex.Lock()
 	if paused { //un-pausing
 		res.CompletedTurns = completedTurns
-	} else { // pausing
-		res.CompletedTurns = completedTurns + 1
+	} else { // pausing, which takes effect once the turn (or batch of turns) in progress is finished
+		res.CompletedTurns = targetTurn
 	}
 	paused = !paused
 	mutex.Unlock()
@@ -263,22 +402,78 @@ func (b *BrokerOperations) PauseProcessingToggle(req stubs.Request, res *stubs.R
 }
 
 func (b *BrokerOperations) CloseClientConnection(req stubs.Request, res *stubs.Response) (err error) {
-	//the client wants to disconnect, so we will set terminate to true
+	//the client wants to disconnect, so its own session is set to terminate, leaving any other session alone
 	mutex.Lock()
-	terminate = true
+	if s := clientSession(req.Session); s != nil {
+		s.terminate = true
+	}
 	mutex.Unlock()
 
 	return
 }
 
+// RegisterWorker is called by a server when it starts up. it joins the pool at the next turn boundary.
+// a broker with a fixed pool turns it away
+func (b *BrokerOperations) RegisterWorker(req stubs.WorkerRequest, res *stubs.WorkerResponse) (err error) {
+	if !dynamicWorkers {
+		return fmt.Errorf("the broker has a fixed pool of workers, so %v can't register. start it with -dynamic", req.Address)
+	}
+	if registerWorker(req.Address) {
+		fmt.Println("Worker", req.Address, "registered")
+	}
+	addresses, _ := currentWorkers()
+	res.NoOfServers = len(addresses)
+
+	return
+}
+
+// DeregisterWorker is called by a server when it shuts down. it leaves the pool at the next turn boundary.
+// a broker with a fixed pool turns it away, and keeps the server in the pool
+func (b *BrokerOperations) DeregisterWorker(req stubs.WorkerRequest, res *stubs.WorkerResponse) (err error) {
+	if !dynamicWorkers {
+		return fmt.Errorf("the broker has a fixed pool of workers, so %v can't deregister", req.Address)
+	}
+	if deregisterWorker(req.Address) {
+		fmt.Println("Worker", req.Address, "deregistered")
+	}
+	addresses, _ := currentWorkers()
+	res.NoOfServers = len(addresses)
+
+	return
+}
+
 func (b *BrokerOperations) CloseAllComponents(req stubs.Request, res *stubs.Response) (err error) {
+	//only a client whose session is running shuts everything down. one still waiting for its turn just has its session ended
+	mutex.Lock()
+	s := clientSession(req.Session)
+	if s != nil {
+		s.terminate = true
+	}
+	mine := s != nil && s == running
+	mutex.Unlock()
+	if !mine {
+		return fmt.Errorf("the client's session isn't the one running, so the broker and servers are left running")
+	}
+
+	//the peer-to-peer engine's world lives on the servers, so it has to be gathered before they are killed
+	engineMutex.Lock()
+	defer engineMutex.Unlock()
+	if p2p != nil {
+		p2p.collect()
+	}
+
 	mutex.Lock()
-	for _, server := range servers {
-		//iterates over all servers and sends a kill request to all of them
+	addresses, _ := currentWorkers()
+	for _, address := range addresses {
+		//iterates over all registered servers and sends a kill request to all of them
+		server, dialErr := rpc.Dial("tcp", address)
+		if dialErr != nil {
+			continue
+		}
 		server.Call(stubs.KillServer, req, res)
+		server.Close()
 	}
 	time.Sleep(25 * time.Millisecond)
-	terminate = true
 	killBroker = true
 	mutex.Unlock()
 
@@ -287,19 +482,56 @@ func (b *BrokerOperations) CloseAllComponents(req stubs.Request, res *stubs.Resp
 
 func main() {
 	pAddr := flag.String("port", "8030", "Port to listen on")
+	pWorkers := flag.String("workers", "", "Comma separated list of worker addresses (overrides "+workersEnv+" and -config)")
+	pConfig := flag.String("config", "", "Path to a file listing one worker address per line")
+	flag.StringVar(&defaultEngine, "engine", "stitch", "Engine to use when the client doesn't choose one: stitch, p2p or hashlife")
+	flag.IntVar(&p2pBatch, "advance", 100, "Number of turns the p2p engine asks the servers to advance per command")
+	flag.IntVar(&p2pCollectEvery, "collect", 10, "Number of advance commands between the p2p engine gathering the world from the servers, which a failed server takes it back to. 0 only gathers it when needed")
+	flag.IntVar(&p2pRetries, "retries", 3, "Number of times the p2p engine tries a batch again after a server fails to advance it, before ending the session with an error")
+	flag.BoolVar(&dynamicWorkers, "dynamic", false, "Start with an empty worker pool, processing turns locally until servers register themselves")
+	flag.BoolVar(&haloExchange, "halo", true, "Only send each worker its slice plus a halo row either side, rather than the whole world. without it, the stitch engine turns away clients asking for more than one turn per batch")
+	flag.DurationVar(&workerTimeout, "timeout", 5*time.Second, "How long to wait for a worker before retrying its slice elsewhere")
+	flag.StringVar(&kernel.TableDir, "rules", "rules", "Folder to load rule tables from, as <name>.rule")
+	flag.StringVar(&checkpointDir, "checkpoints", "", "Folder to write the session to as "+sessionCheckpoint+", and recover it from on start up. Leave empty not to")
+	flag.DurationVar(&checkpointEvery, "checkpoint-every", time.Minute, "How often to write the session to the checkpoints folder, which has to be more than 0")
 	flag.Parse()
+
+	if checkpointDir != "" && checkpointEvery <= 0 {
+		log.Fatal("-checkpoint-every has to be more than 0")
+	}
+
+	if !dynamicWorkers {
+		workers, err := loadWorkers(*pWorkers, *pConfig)
+		if err != nil {
+			log.Fatal("could not load the worker list: ", err)
+		}
+		ips = workers
+	}
+
 	//registers the brokerOperations with rpc, to allow the client to call these functions
 	rpc.Register(&BrokerOperations{})
-	listener, _ := net.Listen("tcp", ":"+*pAddr)
+	listener, err := net.Listen("tcp", ":"+*pAddr)
+	if err != nil {
+		log.Fatal("could not listen on port ", *pAddr, ": ", err)
+	}
 	defer listener.Close()
 	//checks if the broker is supposed to be killed
 	go func() {
 		for {
+			//polls rather than spins, so this goroutine doesn't hog a core the workers need
+			time.Sleep(100 * time.Millisecond)
 			if killBroker {
 				time.Sleep(1 * time.Second)
 				listener.Close()
 			}
 		}
 	}()
+	if checkpointDir != "" {
+		if err := os.MkdirAll(checkpointDir, os.ModePerm); err != nil {
+			log.Fatal("could not make the checkpoints folder: ", err)
+		}
+		//the recovered session is begun before any client can connect, so a client's session always takes over from it
+		recoverSession()
+	}
 	rpc.Accept(listener)
 }
@@ -0,0 +1,423 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"net"
+	"net/rpc"
+	"os/exec"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"uk.ac.bris.cs/gameoflife/kernel"
+	"uk.ac.bris.cs/gameoflife/stubs"
+	"uk.ac.bris.cs/gameoflife/util"
+)
+
+// buildCommand builds one of the commands in this module, such as the server, into a temporary folder and returns its path
+func buildCommand(t *testing.T, name string) string {
+	path := filepath.Join(t.TempDir(), name)
+	build := exec.Command("go", "build", "-o", path, "uk.ac.bris.cs/gameoflife/"+name)
+	if output, err := build.CombinedOutput(); err != nil {
+		t.Fatalf("could not build the %v: %v\n%s", name, err, output)
+	}
+	return path
+}
+
+// freeAddress finds a port on this machine that nothing is listening on
+func freeAddress(t *testing.T) string {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	return listener.Addr().String()
+}
+
+// startServer runs the server binary on the given address with any other flags, and waits until it can be dialled. it is killed when the test finishes
+func startServer(t *testing.T, binary, address string, flags ...string) *exec.Cmd {
+	_, port, _ := net.SplitHostPort(address)
+	server := exec.Command(binary, append([]string{"-port", port, "-threads", "2"}, flags...)...)
+	if err := server.Start(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		server.Process.Kill()
+		server.Wait()
+	})
+	awaitListening(t, address)
+	return server
+}
+
+// awaitListening waits until something is listening on the given address
+func awaitListening(t *testing.T, address string) {
+	for start := time.Now(); time.Since(start) < 10*time.Second; time.Sleep(10 * time.Millisecond) {
+		if conn, err := net.Dial("tcp", address); err == nil {
+			conn.Close()
+			return
+		}
+	}
+	t.Fatalf("nothing is listening on %v", address)
+}
+
+// useWorkers points the broker at a fixed pool of servers, forgetting any connections and turns left over from an earlier test
+func useWorkers(addresses []string) {
+	workersMutex.Lock()
+	ips = append([]string{}, addresses...)
+	workersVersion++
+	workersMutex.Unlock()
+	mutex.Lock()
+	completedTurns = 0
+	currentWorld = util.BitBoard{}
+	mutex.Unlock()
+	servers = nil
+	serverAddresses = nil
+	dynamicWorkers = false
+	haloExchange = true
+	workerTimeout = time.Second
+	p2pBatch = 10
+	p2pCollectEvery = 10
+	p2pRetries = 3
+}
+
+// randomWorld is a world of the given size with roughly a third of its cells alive
+func randomWorld(width, height int) util.BitBoard {
+	random := rand.New(rand.NewSource(1))
+	world := util.NewBitBoard(width, height)
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			world.Set(x, y, random.Intn(3) == 0)
+		}
+	}
+	return world
+}
+
+// advanceWorld is the world after the given number of turns of Conway's Game of Life on a torus, worked out without the servers
+func advanceWorld(world util.BitBoard, turns int) util.BitBoard {
+	rule, _ := kernel.ParseRule("")
+	world = world.Copy()
+	rowsChan := make(chan [][]uint64, 1)
+	for t := 0; t < turns; t++ {
+		kernel.UpdateCells(world, 0, world.Height, rule, util.Torus, rowsChan)
+		world.Rows = <-rowsChan
+	}
+	return world
+}
+
+// awaitTurn waits until the session being run has completed the given turn
+func awaitTurn(t *testing.T, turn int) {
+	for start := time.Now(); time.Since(start) < 30*time.Second; time.Sleep(time.Millisecond) {
+		mutex.Lock()
+		completed := completedTurns
+		mutex.Unlock()
+		if completed >= turn {
+			return
+		}
+	}
+	t.Fatalf("the session didn't reach turn %v", turn)
+}
+
+// sameWorld checks two worlds have the same cells alive
+func sameWorld(t *testing.T, got, want util.BitBoard) {
+	t.Helper()
+	if got.Width != want.Width || got.Height != want.Height {
+		t.Fatalf("the world is %vx%v, rather than %vx%v", got.Width, got.Height, want.Width, want.Height)
+	}
+	for y := 0; y < want.Height; y++ {
+		for x := 0; x < want.Width; x++ {
+			if got.Alive(x, y) != want.Alive(x, y) {
+				t.Fatalf("the world differs from an uninterrupted run at (%v, %v)", x, y)
+			}
+		}
+	}
+}
+
+// TestWorkerFailure tests a session carries on to the same world when one of a fixed pool of servers is killed part way through,
+// without CompletedTurns going backwards, and that the server is kept in the pool, so it takes its slice back when it is started again
+func TestWorkerFailure(t *testing.T) {
+	binary := buildCommand(t, "server")
+	const turns = 1000
+	world := randomWorld(64, 64)
+	want := advanceWorld(world, turns)
+
+	tests := []struct {
+		engine string
+	}{
+		{engine: "stitch"},
+		{engine: "p2p"},
+	}
+	for _, test := range tests {
+		t.Run(test.engine, func(t *testing.T) {
+			addresses := make([]string, 4)
+			workers := make([]*exec.Cmd, 4)
+			for i := range addresses {
+				addresses[i] = freeAddress(t)
+				workers[i] = startServer(t, binary, addresses[i])
+			}
+			useWorkers(addresses)
+
+			//CompletedTurns shouldn't go backwards, even while the servers go back over the turns since the world was last gathered
+			finished := make(chan bool)
+			backwards := make(chan string, 1)
+			go func() {
+				last := 0
+				for {
+					select {
+					case <-finished:
+						close(backwards)
+						return
+					case <-time.After(time.Millisecond):
+					}
+					mutex.Lock()
+					completed := completedTurns
+					mutex.Unlock()
+					if completed < last && len(backwards) == 0 {
+						backwards <- fmt.Sprintf("CompletedTurns went from %v back to %v", last, completed)
+					}
+					last = completed
+				}
+			}()
+
+			done := make(chan error, 1)
+			res := new(stubs.Response)
+			go func() {
+				beginSession(&session{})
+				done <- runSession(stubs.Request{
+					ImageWidth:  world.Width,
+					ImageHeight: world.Height,
+					Turns:       turns,
+					World:       world,
+					Engine:      test.engine,
+				}, res)
+			}()
+
+			awaitTurn(t, turns/4)
+			workers[1].Process.Kill()
+			workers[1].Wait()
+			awaitTurn(t, turns/2)
+			startServer(t, binary, addresses[1])
+
+			err := <-done
+			close(finished)
+			for message := range backwards {
+				t.Error(message)
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if res.TerminateTurns != turns {
+				t.Fatalf("the session stopped on turn %v, rather than %v", res.TerminateTurns, turns)
+			}
+			sameWorld(t, res.World, want)
+			if workers, _ := currentWorkers(); len(workers) != len(addresses) {
+				t.Errorf("the pool is %v after a server was killed, rather than %v", workers, addresses)
+			}
+		})
+	}
+}
+
+// TestCurrentState tests the world saved part way through a session is always the world on the turn it is saved with,
+// including on the p2p engine, whose world is only on the broker when it is gathered from the servers
+func TestCurrentState(t *testing.T) {
+	binary := buildCommand(t, "server")
+	const turns = 300
+	world := randomWorld(64, 64)
+
+	tests := []struct {
+		engine string
+	}{
+		{engine: "stitch"},
+		{engine: "p2p"},
+	}
+	for _, test := range tests {
+		t.Run(test.engine, func(t *testing.T) {
+			addresses := make([]string, 2)
+			for i := range addresses {
+				addresses[i] = freeAddress(t)
+				startServer(t, binary, addresses[i])
+			}
+			useWorkers(addresses)
+			p2pCollectEvery = 0
+
+			done := make(chan error, 1)
+			go func() {
+				beginSession(&session{})
+				done <- runSession(stubs.Request{ImageWidth: world.Width, ImageHeight: world.Height, Turns: turns, World: world, Engine: test.engine,
+					TurnsPerBatch: 3}, new(stubs.Response))
+			}()
+			for {
+				select {
+				case err := <-done:
+					if err != nil {
+						t.Fatal(err)
+					}
+					return
+				case <-time.After(5 * time.Millisecond):
+				}
+				saved, turn, err := currentState()
+				if err != nil {
+					t.Fatal(err)
+				}
+				//the session may not have sent its first world yet
+				if saved.Height > 0 {
+					sameWorld(t, saved, advanceWorld(world, turn))
+				}
+			}
+		})
+	}
+}
+
+// TestWholeWorldBatches tests a session asking for more than one turn per batch is turned away when the stitch engine sends the whole world
+func TestWholeWorldBatches(t *testing.T) {
+	useWorkers(nil)
+	haloExchange = false
+	defer func() { haloExchange = true }()
+
+	world := randomWorld(64, 64)
+	tests := []struct {
+		engine        string
+		turnsPerBatch int
+		err           bool
+	}{
+		{engine: "stitch", turnsPerBatch: 1},
+		{engine: "stitch", turnsPerBatch: 10, err: true},
+		{engine: "p2p", turnsPerBatch: 10},
+		{engine: "hashlife", turnsPerBatch: 10},
+	}
+	for _, test := range tests {
+		t.Run(fmt.Sprintf("%v-%v", test.engine, test.turnsPerBatch), func(t *testing.T) {
+			beginSession(&session{})
+			err := runSession(stubs.Request{
+				ImageWidth:    world.Width,
+				ImageHeight:   world.Height,
+				Turns:         20,
+				World:         world,
+				Engine:        test.engine,
+				TurnsPerBatch: test.turnsPerBatch,
+			}, new(stubs.Response))
+			if test.err && err == nil {
+				t.Error("the session should have been turned away")
+			}
+			if !test.err && err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+// failingServer takes its slice, then fails every Advance with an error, as a server whose neighbours can never be reached would
+type failingServer struct {
+	advances int32
+}
+
+func (s *failingServer) LoadSlice(req stubs.LoadSliceRequest, res *stubs.SessionResponse) error {
+	res.Turn = req.Turn
+	return nil
+}
+
+func (s *failingServer) Advance(req stubs.AdvanceRequest, res *stubs.AdvanceResponse) error {
+	atomic.AddInt32(&s.advances, 1)
+	return errors.New("the halo rows never arrived")
+}
+
+// TestAdvanceRetries tests the p2p engine tries a batch a server keeps failing only so many times, then ends the session with an error,
+// on the last world it gathered rather than one the servers never got to
+func TestAdvanceRetries(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	server := new(failingServer)
+	rpcServer := rpc.NewServer()
+	if err := rpcServer.RegisterName("GolOperations", server); err != nil {
+		t.Fatal(err)
+	}
+	go rpcServer.Accept(listener)
+	useWorkers([]string{listener.Addr().String()})
+
+	world := randomWorld(64, 64)
+	res := new(stubs.Response)
+	beginSession(&session{})
+	err = runSession(stubs.Request{ImageWidth: world.Width, ImageHeight: world.Height, Turns: 100, World: world, Engine: "p2p"}, res)
+	if err == nil {
+		t.Fatal("the session should have ended with an error")
+	}
+	if advances := atomic.LoadInt32(&server.advances); advances != int32(p2pRetries+1) {
+		t.Errorf("the batch was tried %v times, rather than %v", advances, p2pRetries+1)
+	}
+	if res.TerminateTurns != 0 {
+		t.Errorf("the session stopped on turn %v, rather than 0", res.TerminateTurns)
+	}
+	sameWorld(t, res.World, world)
+}
+
+// TestClientSessions tests a client's q key only stops its own session, whether it is running or still waiting for the one before it to stop,
+// and that its k key doesn't shut the broker down while another client's session is running
+func TestClientSessions(t *testing.T) {
+	useWorkers(nil)
+	world := randomWorld(64, 64)
+	const turns = 1000000
+
+	// start runs a client's session in the background, returning the turn it stops on
+	start := func(id int64) chan int {
+		stopped := make(chan int, 1)
+		go func() {
+			res := new(stubs.Response)
+			err := new(BrokerOperations).Broker(stubs.Request{ImageWidth: world.Width, ImageHeight: world.Height, Turns: turns, World: world,
+				Engine: "stitch", Session: id}, res)
+			if err != nil {
+				t.Error(err)
+			}
+			stopped <- res.TerminateTurns
+		}()
+		return stopped
+	}
+	quit := func(id int64) {
+		if err := new(BrokerOperations).CloseClientConnection(stubs.Request{Session: id}, new(stubs.Response)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	first := start(1)
+	awaitTurn(t, 10)
+	second := start(2)
+	for start := time.Now(); ; time.Sleep(time.Millisecond) {
+		mutex.Lock()
+		_, queued := waiting[2]
+		mutex.Unlock()
+		if queued {
+			break
+		}
+		if time.Since(start) > 10*time.Second {
+			t.Fatal("the second session didn't start waiting")
+		}
+	}
+
+	//the second client quits while it is waiting, and a client whose session has already gone quits, neither of which stops the first
+	quit(2)
+	quit(3)
+	if err := new(BrokerOperations).CloseAllComponents(stubs.Request{Session: 2}, new(stubs.Response)); err == nil {
+		t.Error("k from a client whose session isn't running shut the broker down")
+	}
+	mutex.Lock()
+	reached := completedTurns
+	mutex.Unlock()
+	awaitTurn(t, reached+10)
+	select {
+	case turn := <-first:
+		t.Fatalf("the first session stopped on turn %v when another client quit", turn)
+	default:
+	}
+
+	quit(1)
+	if turn := <-first; turn >= turns {
+		t.Errorf("the first session ran to turn %v, rather than stopping when its client quit", turn)
+	}
+	if turn := <-second; turn != 0 {
+		t.Errorf("the second session ran to turn %v, after its client had quit", turn)
+	}
+}
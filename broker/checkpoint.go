@@ -0,0 +1,133 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"uk.ac.bris.cs/gameoflife/kernel"
+	"uk.ac.bris.cs/gameoflife/stubs"
+	"uk.ac.bris.cs/gameoflife/util"
+)
+
+// broker-side checkpoints. with a checkpoints folder, the broker writes the session it is running to sessionCheckpoint every checkpointEvery,
+// and once more when it ends, however it ends. a broker started with a session there that hadn't reached its last turn carries on with it,
+// writing checkpoints as it goes, until it finishes or a client starts a session of its own
+
+// the folder checkpoints are written to, which is empty when the broker doesn't write them, and how often they are written
+var checkpointDir string
+var checkpointEvery time.Duration
+
+// the checkpoint of the session being run, and where a recovered session that a client has taken over from is kept
+const sessionCheckpoint = "session.checkpoint"
+const recoveredCheckpoint = "recovered.checkpoint"
+
+// sessionMutex is held by the session being run, so a client starting a session waits for the one before it to stop
+var sessionMutex sync.Mutex
+
+// saveCheckpoints writes the session to its checkpoint every checkpointEvery until the function it returns is called,
+// which waits for any checkpoint being written to finish
+func saveCheckpoints(req stubs.Request) func() {
+	if checkpointDir == "" {
+		return func() {}
+	}
+	stop := make(chan bool)
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		ticker := time.NewTicker(checkpointEvery)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				world, turn, err := currentState()
+				if err != nil {
+					fmt.Println("Could not gather the world for a checkpoint:", err)
+					continue
+				}
+				writeCheckpoint(sessionCheckpoint, req, world, turn)
+			}
+		}
+	}()
+	return func() {
+		close(stop)
+		wg.Wait()
+	}
+}
+
+// writeCheckpoint writes the world of a session on a turn to a checkpoint in the checkpoints folder, along with the request that started it.
+// a checkpoint that can't be written is reported, but doesn't stop the session
+func writeCheckpoint(name string, req stubs.Request, world util.BitBoard, turn int) {
+	if checkpointDir == "" {
+		return
+	}
+	boundary, _ := util.ParseBoundary(req.Boundary)
+	err := util.WriteCheckpoint(filepath.Join(checkpointDir, name), util.Checkpoint{
+		Version:       util.EngineVersion,
+		Engine:        req.Engine,
+		Width:         req.ImageWidth,
+		Height:        req.ImageHeight,
+		Turn:          turn,
+		Turns:         req.Turns,
+		TurnsPerBatch: req.TurnsPerBatch,
+		Rule:          req.Rule,
+		Boundary:      boundary.String(),
+		World:         world.Unpack(),
+	})
+	if err != nil {
+		fmt.Println("Could not write a checkpoint:", err)
+	}
+}
+
+// recoverSession carries on with the session in the checkpoints folder, if the broker stopped before it reached its last turn.
+// the session is begun before it returns, and runs in the background
+func recoverSession() {
+	path := filepath.Join(checkpointDir, sessionCheckpoint)
+	cp, err := util.ReadCheckpoint(path)
+	if os.IsNotExist(err) {
+		return
+	}
+	if err != nil {
+		fmt.Println("Could not recover the session:", err)
+		return
+	}
+	if cp.Version != util.EngineVersion {
+		fmt.Println("Could not recover the session:", path, "was written by version", cp.Version, "of the engine, not this version,", util.EngineVersion)
+		return
+	}
+	if cp.Turn >= cp.Turns {
+		return
+	}
+	rule, err := kernel.ParseRule(cp.Rule)
+	if err != nil {
+		fmt.Println("Could not recover the session:", err)
+		return
+	}
+
+	fmt.Println("Recovering the session in", path, "on turn", cp.Turn, "of", cp.Turns)
+	req := stubs.Request{
+		ImageWidth:    cp.Width,
+		ImageHeight:   cp.Height,
+		Turns:         cp.Turns,
+		World:         util.PackStates(cp.World, rule.States),
+		Engine:        cp.Engine,
+		TurnsPerBatch: cp.TurnsPerBatch,
+		Rule:          cp.Rule,
+		Boundary:      cp.Boundary,
+		StartTurn:     cp.Turn,
+	}
+	beginSession(&session{recovered: true})
+	go func() {
+		res := new(stubs.Response)
+		if err := runSession(req, res); err != nil {
+			fmt.Println("Could not recover the session:", err)
+			return
+		}
+		fmt.Println("Recovered session stopped on turn", res.TerminateTurns)
+	}()
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"net"
+	"net/rpc"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"uk.ac.bris.cs/gameoflife/stubs"
+	"uk.ac.bris.cs/gameoflife/util"
+)
+
+// startBroker runs the broker binary on the given address with the given flags and waits until it can be dialled. it is killed when the test finishes
+func startBroker(t *testing.T, binary, address string, flags ...string) *exec.Cmd {
+	_, port, _ := net.SplitHostPort(address)
+	broker := exec.Command(binary, append([]string{"-port", port}, flags...)...)
+	if err := broker.Start(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		broker.Process.Kill()
+		broker.Wait()
+	})
+	awaitListening(t, address)
+	return broker
+}
+
+// awaitCheckpoint waits until the named checkpoint in the folder is on a turn that done accepts, and returns it
+func awaitCheckpoint(t *testing.T, dir, name string, done func(cp util.Checkpoint) bool) util.Checkpoint {
+	for start := time.Now(); time.Since(start) < 30*time.Second; time.Sleep(10 * time.Millisecond) {
+		if cp, err := util.ReadCheckpoint(filepath.Join(dir, name)); err == nil && done(cp) {
+			return cp
+		}
+	}
+	t.Fatalf("%v wasn't written in time", name)
+	return util.Checkpoint{}
+}
+
+// TestRecoverSession tests a broker killed part way through a session carries on with it from its checkpoint when it is started again,
+// finishing on the same world as an uninterrupted run, and that a client connecting straight after the restart takes over from it
+func TestRecoverSession(t *testing.T) {
+	server := buildCommand(t, "server")
+	broker := buildCommand(t, "broker")
+	addresses := make([]string, 2)
+	for i := range addresses {
+		addresses[i] = freeAddress(t)
+		startServer(t, server, addresses[i])
+	}
+
+	const turns = 2000
+	world := randomWorld(128, 128)
+	req := stubs.Request{ImageWidth: world.Width, ImageHeight: world.Height, Turns: turns, World: world, Engine: "stitch"}
+
+	// interrupt starts a broker writing checkpoints to the folder, kills it once it has written one part way through the session,
+	// then starts it again. it returns the address of the restarted broker and the turn of the checkpoint it recovers from
+	interrupt := func(t *testing.T, dir string) (string, int) {
+		address := freeAddress(t)
+		flags := []string{"-workers", strings.Join(addresses, ","), "-checkpoints", dir, "-checkpoint-every", "50ms"}
+		first := startBroker(t, broker, address, flags...)
+		client, err := rpc.Dial("tcp", address)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer client.Close()
+		call := client.Go(stubs.Broker, req, new(stubs.Response), nil)
+
+		cp := awaitCheckpoint(t, dir, sessionCheckpoint, func(cp util.Checkpoint) bool { return cp.Turn > 0 })
+		first.Process.Kill()
+		first.Wait()
+		<-call.Done
+		if cp.Turn >= turns {
+			t.Fatalf("the session finished before the broker was killed")
+		}
+
+		startBroker(t, broker, address, flags...)
+		return address, cp.Turn
+	}
+
+	t.Run("finishes", func(t *testing.T) {
+		dir := t.TempDir()
+		interrupt(t, dir)
+		cp := awaitCheckpoint(t, dir, sessionCheckpoint, func(cp util.Checkpoint) bool { return cp.Turn == cp.Turns })
+		if cp.Turns != turns {
+			t.Fatalf("the recovered session ran %v turns, rather than %v", cp.Turns, turns)
+		}
+		sameWorld(t, util.PackStates(cp.World, 2), advanceWorld(world, turns))
+	})
+
+	t.Run("taken over", func(t *testing.T) {
+		dir := t.TempDir()
+		address, from := interrupt(t, dir)
+
+		client, err := rpc.Dial("tcp", address)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer client.Close()
+		small := randomWorld(16, 16)
+		res := new(stubs.Response)
+		err = client.Call(stubs.Broker, stubs.Request{ImageWidth: 16, ImageHeight: 16, Turns: 10, World: small, Engine: "stitch"}, res)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res.TerminateTurns != 10 {
+			t.Fatalf("the client's session stopped on turn %v, rather than 10", res.TerminateTurns)
+		}
+		sameWorld(t, res.World, advanceWorld(small, 10))
+
+		cp, err := util.ReadCheckpoint(filepath.Join(dir, recoveredCheckpoint))
+		if err != nil {
+			t.Fatalf("the recovered session wasn't kept: %v", err)
+		}
+		if cp.Turn < from || cp.Turn >= turns {
+			t.Fatalf("the recovered session was kept on turn %v, which isn't between %v and %v", cp.Turn, from, turns)
+		}
+		sameWorld(t, util.PackStates(cp.World, 2), advanceWorld(world, cp.Turn))
+		if cp, err := util.ReadCheckpoint(filepath.Join(dir, sessionCheckpoint)); err != nil || cp.Width != 16 || cp.Turn != 10 {
+			t.Errorf("the client's session wasn't written to %v", sessionCheckpoint)
+		}
+	})
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"uk.ac.bris.cs/gameoflife/hashlife"
+	"uk.ac.bris.cs/gameoflife/kernel"
+	"uk.ac.bris.cs/gameoflife/stubs"
+	"uk.ac.bris.cs/gameoflife/util"
+)
+
+// runHashLife is the HashLife engine. the broker advances the world itself, without the servers, in jumps that double in size
+// (1, 1, 2, 4, 8...) so CompletedTurns keeps moving early on, then shrink again to land exactly on Turns.
+// TurnsPerBatch, if given, caps the size of a jump. it returns the number of turns completed before finishing or being asked to terminate
+func runHashLife(world util.BitBoard, req stubs.Request, updateState chan stateUpdate) int {
+	//runSession has checked HashLife supports the world, rule and boundary
+	rule, _ := kernel.ParseRule(req.Rule)
+	Turns := req.Turns
+	TurnsPerBatch := req.TurnsPerBatch
+	life := hashlife.New(world, rule)
+
+	turn := req.StartTurn
+	for turn < Turns {
+		//the largest power of two that turn is a multiple of
+		turns := turn & -turn
+		if turns == 0 {
+			turns = 1
+		}
+		for turns > Turns-turn {
+			turns /= 2
+		}
+		if TurnsPerBatch > 0 && turns > TurnsPerBatch {
+			turns = TurnsPerBatch
+		}
+		if !startTurns(turn + turns) {
+			break
+		}
+
+		life.Advance(turns)
+		turn += turns
+
+		world = life.Board()
+		currentAliveCells = world.AliveCells()
+		currentAliveCellCount = len(currentAliveCells)
+
+		// send the current state down the channel
+		updateState <- stateUpdate{turns: turn, numAliveCells: currentAliveCellCount, aliveCells: currentAliveCells, world: world}
+	}
+
+	return turn
+}
@@ -0,0 +1,317 @@
+package main
+
+import (
+	"fmt"
+	"net/rpc"
+	"sync"
+	"time"
+
+	"uk.ac.bris.cs/gameoflife/kernel"
+	"uk.ac.bris.cs/gameoflife/stubs"
+	"uk.ac.bris.cs/gameoflife/util"
+)
+
+// the peer-to-peer engine. each server keeps its slice of the world between turns and swaps halo rows directly with
+// the servers either side of it, so the broker only issues Advance commands and collects alive counts.
+// the world is only gathered back onto the broker when it is needed: for the s and k keys, rebalancing and the end of the run,
+// and every p2pCollectEvery batches so a failed server only loses the turns since then
+
+// engineMutex is held while the servers are advancing, so the world is only ever gathered at a turn boundary
+var engineMutex sync.Mutex
+
+// p2p is the peer-to-peer run in progress, or nil when the stitch engine is in use. it is guarded by engineMutex,
+// and is kept until runSession has the final world, so the world is always gathered through it while the run is in progress
+var p2p *p2pEngine
+
+// number of turns the servers are asked to advance per command, when the client doesn't ask for a TurnsPerBatch
+var p2pBatch int
+
+// number of batches between gathering the world back from the servers. 0 only gathers it when it is needed
+var p2pCollectEvery int
+
+// number of times a batch is tried again after a server fails to advance it, before the session ends with an error
+var p2pRetries int
+
+// p2pSessions numbers every load of the world onto the servers, so halo rows left over from an earlier load are ignored
+var p2pSessions int
+
+type p2pEngine struct {
+	session   int
+	rule      string
+	boundary  string
+	servers   []*rpc.Client
+	addresses []string
+	loaded    bool
+
+	//the turn the world on the servers is at
+	turn int
+
+	//the last world loaded onto or gathered from the servers, and the turn it is at.
+	//if a server fails, the run carries on from here
+	world     util.BitBoard
+	worldTurn int
+}
+
+// runP2P is the peer-to-peer engine. it returns the number of turns completed before finishing or being asked to terminate,
+// and an error if the servers kept failing to advance a batch
+func runP2P(world util.BitBoard, req stubs.Request, updateState chan stateUpdate) (int, error) {
+	Turns := req.Turns
+	TurnsPerBatch := req.TurnsPerBatch
+	if TurnsPerBatch < 1 {
+		TurnsPerBatch = p2pBatch
+	}
+
+	e := &p2pEngine{world: world, rule: req.Rule, boundary: req.Boundary, turn: req.StartTurn, worldTurn: req.StartTurn}
+	engineMutex.Lock()
+	p2p = e
+	engineMutex.Unlock()
+	workersSeen := -1
+
+	//the turn last sent to the global state store. after a failure the servers go back over turns already reported, which aren't reported again
+	reported := req.StartTurn
+	batches := 0
+	//the number of times the batch being run has failed
+	failures := 0
+	var err error
+
+	turn := req.StartTurn
+	for turn < Turns {
+		turns := TurnsPerBatch
+		if Turns-turn < turns {
+			turns = Turns - turn
+		}
+		if !startTurns(turn + turns) {
+			break
+		}
+
+		engineMutex.Lock()
+		//k may have been pressed while waiting for the lock
+		mutex.Lock()
+		terminating := running.terminate
+		mutex.Unlock()
+		if terminating {
+			engineMutex.Unlock()
+			break
+		}
+
+		//at the turn boundary, rebalance the rows across whichever workers are currently registered,
+		//or when servers in a fixed pool that were unreachable have been redialled
+		if !e.loaded || workersChanged(workersSeen) {
+			//the world is gathered first, so the servers carry on from this turn rather than the last world the broker has
+			if e.loaded {
+				e.collect()
+			}
+			var addresses []string
+			addresses, workersSeen = currentWorkers()
+			e.load(addresses)
+		}
+
+		//on the last try, servers that fail with an error are dropped as well as ones that time out
+		numAlive, advanceErr := e.advance(turns, failures == p2pRetries)
+		if advanceErr != nil {
+			//a server has failed, so the run carries on from the last world the broker has on any servers that are left
+			fmt.Println("Advance failed:", advanceErr)
+			e.loaded = false
+			e.turn = e.worldTurn
+			turn = e.worldTurn
+			engineMutex.Unlock()
+			if failures++; failures > p2pRetries {
+				err = fmt.Errorf("the servers failed to advance turn %v %v times: %v", turn, failures, advanceErr)
+				break
+			}
+			continue
+		}
+		failures = 0
+		turn = e.turn
+		batches++
+		if p2pCollectEvery > 0 && batches%p2pCollectEvery == 0 {
+			if _, err := e.collect(); err != nil {
+				fmt.Println("Collect failed:", err)
+				turn = e.worldTurn
+			}
+		}
+		engineMutex.Unlock()
+
+		// send the current state down the channel. the world stays on the servers, so it is left out, and currentState gathers it instead
+		if turn > reported {
+			reported = turn
+			updateState <- stateUpdate{turns: turn, numAliveCells: numAlive}
+		}
+	}
+
+	//gathers the final world from the servers. if they have gone, the last world the broker has is used
+	engineMutex.Lock()
+	if e.loaded {
+		e.collect()
+	}
+	world, turn = e.world, e.worldTurn
+	engineMutex.Unlock()
+
+	currentAliveCells = world.AliveCells()
+	currentAliveCellCount = len(currentAliveCells)
+	updateState <- stateUpdate{turns: turn, numAliveCells: currentAliveCellCount, aliveCells: currentAliveCells, world: world}
+
+	return turn, err
+}
+
+// load shares the broker's copy of the world out between the servers at the given addresses.
+// every slice needs at least as many rows as the rule's radius to fill its neighbours' halos, so any extra servers are left idle.
+// with no servers, the broker advances the world itself
+func (e *p2pEngine) load(addresses []string) {
+	ImageHeight := e.world.Height
+	rule, _ := kernel.ParseRule(e.rule)
+	if len(addresses) > ImageHeight/rule.Radius {
+		addresses = addresses[:ImageHeight/rule.Radius]
+	}
+	connectServers(addresses)
+
+	//a server that fails to take its slice is dropped, and the world is shared out again between the rest
+	for !e.loadRing(addresses) {
+	}
+}
+
+// loadRing shares the world out between the connected servers, leaving out any that couldn't be reached.
+// it returns false if a server failed to take its slice
+func (e *p2pEngine) loadRing(addresses []string) bool {
+	ImageHeight := e.world.Height
+	e.servers = make([]*rpc.Client, 0, len(servers))
+	e.addresses = make([]string, 0, len(servers))
+	for i, server := range servers {
+		if server != nil {
+			e.servers = append(e.servers, server)
+			e.addresses = append(e.addresses, addresses[i])
+		}
+	}
+
+	p2pSessions++
+	e.session = p2pSessions
+	e.turn = e.worldTurn
+	e.loaded = true
+
+	numberOfServers := len(e.servers)
+	for i, server := range e.servers {
+		startIndex, endIndex := stubs.SliceBounds(ImageHeight, numberOfServers, i)
+		loadReq := stubs.LoadSliceRequest{
+			Session:  e.session,
+			Rows:     e.world.Slice(startIndex, endIndex),
+			Turn:     e.turn,
+			Rule:     e.rule,
+			Boundary: e.boundary,
+			Above:    e.addresses[(i-1+numberOfServers)%numberOfServers],
+			Below:    e.addresses[(i+1)%numberOfServers],
+			Top:      i == 0,
+			Bottom:   i == numberOfServers-1,
+		}
+		if !awaitCall(server.Go(stubs.LoadSlice, loadReq, new(stubs.SessionResponse), nil)) {
+			dropWorker(e.addresses[i], server)
+			return false
+		}
+	}
+	return true
+}
+
+// advance asks every server to advance its slice by the given number of turns and returns the total number of alive cells.
+// with drop set, a server that fails with an error is dropped from the pool (see awaitAdvance)
+func (e *p2pEngine) advance(turns int, drop bool) (int, error) {
+	if len(e.servers) == 0 {
+		return e.advanceLocally(turns), nil
+	}
+
+	advanceReq := stubs.AdvanceRequest{Session: e.session, Turns: turns, Timeout: workerTimeout}
+	responses := make([]*stubs.AdvanceResponse, len(e.servers))
+	doneProcessing := make([]*rpc.Call, len(e.servers))
+	for i, server := range e.servers {
+		responses[i] = new(stubs.AdvanceResponse)
+		doneProcessing[i] = server.Go(stubs.Advance, advanceReq, responses[i], nil)
+	}
+
+	numAlive := 0
+	var err error
+	for i := range e.servers {
+		if callErr := e.awaitAdvance(i, doneProcessing[i], workerTimeout*time.Duration(turns), drop); callErr != nil {
+			err = callErr
+			continue
+		}
+		numAlive += responses[i].NumAliveCells
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	e.turn += turns
+	return numAlive, nil
+}
+
+// awaitAdvance waits for server i's Advance call. a server that returns an error is still alive (it may just have lost a neighbour),
+// so it is only dropped from the pool with drop set, but one that times out or whose connection breaks always is
+func (e *p2pEngine) awaitAdvance(i int, call *rpc.Call, timeout time.Duration, drop bool) error {
+	err := fmt.Errorf("worker %v did not advance", e.addresses[i])
+	select {
+	case <-call.Done:
+		if call.Error == nil {
+			return nil
+		}
+		if _, alive := call.Error.(rpc.ServerError); alive {
+			if !drop {
+				return call.Error
+			}
+			err = fmt.Errorf("worker %v could not advance: %v", e.addresses[i], call.Error)
+		}
+	case <-time.After(timeout):
+	}
+	dropWorker(e.addresses[i], e.servers[i])
+	return err
+}
+
+// advanceLocally is used when there are no servers to advance the world on
+func (e *p2pEngine) advanceLocally(turns int) int {
+	rule, _ := kernel.ParseRule(e.rule)
+	boundary, _ := util.ParseBoundary(e.boundary)
+	rowsChan := make(chan [][]uint64, 1)
+	for t := 0; t < turns; t++ {
+		kernel.UpdateCells(e.world, 0, e.world.Height, rule, boundary, rowsChan)
+		e.world.Rows = <-rowsChan
+	}
+	e.turn += turns
+	e.worldTurn = e.turn
+
+	return e.world.Count()
+}
+
+// collect gathers the slices back from the servers into the broker's copy of the world.
+// if that fails, the world is left at the last turn it was gathered at and an error is returned
+func (e *p2pEngine) collect() (util.BitBoard, error) {
+	if !e.loaded || e.worldTurn == e.turn {
+		return e.world, nil
+	}
+
+	rows := make([][]uint64, 0, e.world.Height)
+	for i, server := range e.servers {
+		res := new(stubs.ServerResponse)
+		if !awaitCall(server.Go(stubs.CollectSlice, stubs.SessionRequest{Session: e.session}, res, nil)) {
+			dropWorker(e.addresses[i], server)
+			e.loaded = false
+			e.turn = e.worldTurn
+			return e.world, fmt.Errorf("could not collect the world from worker %v", e.addresses[i])
+		}
+		rows = append(rows, res.World.Rows...)
+	}
+
+	world := e.world.WithRows(rows)
+	e.world = world
+	e.worldTurn = e.turn
+	return world, nil
+}
+
+// dropWorker stops using a failed server in the ring, in the same way as dropServer
+func dropWorker(address string, server *rpc.Client) {
+	for i := range servers {
+		if servers[i] == server {
+			dropServer(i)
+			return
+		}
+	}
+	fmt.Println("Worker", address, "failed")
+	forgetWorker(address)
+	server.Close()
+}
@@ -0,0 +1,323 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"net/rpc"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"uk.ac.bris.cs/gameoflife/kernel"
+	"uk.ac.bris.cs/gameoflife/stubs"
+	"uk.ac.bris.cs/gameoflife/util"
+)
+
+// defaultWorkers is used when no worker list is given through a flag, the environment or a config file
+var defaultWorkers = []string{
+	"127.0.0.1:8031",
+	"127.0.0.1:8032",
+	"127.0.0.1:8033",
+	"127.0.0.1:8034",
+}
+
+// workersEnv is the environment variable holding a comma separated list of worker addresses
+const workersEnv = "GOL_WORKERS"
+
+// loadWorkers works out which GolOperations servers the broker should use.
+// the -workers flag takes priority, then the GOL_WORKERS environment variable, then the -config file, then the defaults.
+// a list with no addresses in it is an error
+func loadWorkers(flagWorkers, configPath string) ([]string, error) {
+	workers, source, err := defaultWorkers, "the defaults", error(nil)
+	if flagWorkers != "" {
+		workers, source = splitWorkers(flagWorkers), "-workers"
+	} else if envWorkers := os.Getenv(workersEnv); envWorkers != "" {
+		workers, source = splitWorkers(envWorkers), workersEnv
+	} else if configPath != "" {
+		workers, err = readWorkersFile(configPath)
+		source = configPath
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(workers) == 0 {
+		return nil, fmt.Errorf("no workers are listed in %v", source)
+	}
+	return workers, nil
+}
+
+// splitWorkers turns a comma separated list such as "10.0.0.1:8031,10.0.0.2:8031" into a slice of addresses
+func splitWorkers(list string) []string {
+	workers := make([]string, 0)
+	for _, address := range strings.Split(list, ",") {
+		address = strings.TrimSpace(address)
+		if address != "" {
+			workers = append(workers, address)
+		}
+	}
+	return workers
+}
+
+// readWorkersFile reads a config file with one worker address per line. blank lines and lines starting with # are ignored
+func readWorkersFile(path string) ([]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	workers := make([]string, 0)
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		workers = append(workers, line)
+	}
+	return workers, scanner.Err()
+}
+
+// workersMutex guards the worker pool. ips is only changed through registerWorker and deregisterWorker,
+// which bump workersVersion so the Broker loop knows to rebalance at the next turn boundary
+var workersMutex sync.Mutex
+var workersVersion int
+
+// registerWorker adds a server to the pool. it returns false if the server was already registered
+func registerWorker(address string) bool {
+	workersMutex.Lock()
+	defer workersMutex.Unlock()
+
+	for _, ip := range ips {
+		if ip == address {
+			return false
+		}
+	}
+	ips = append(ips, address)
+	workersVersion++
+	return true
+}
+
+// deregisterWorker removes a server from the pool. it returns false if the server wasn't registered
+func deregisterWorker(address string) bool {
+	workersMutex.Lock()
+	defer workersMutex.Unlock()
+
+	for i, ip := range ips {
+		if ip == address {
+			ips = append(ips[:i:i], ips[i+1:]...)
+			workersVersion++
+			return true
+		}
+	}
+	return false
+}
+
+// currentWorkers returns a copy of the worker pool along with its version
+func currentWorkers() ([]string, int) {
+	workersMutex.Lock()
+	defer workersMutex.Unlock()
+
+	return append(make([]string, 0, len(ips)), ips...), workersVersion
+}
+
+// workersChanged reports whether the pool has changed since the given version
+func workersChanged(version int) bool {
+	workersMutex.Lock()
+	defer workersMutex.Unlock()
+
+	return workersVersion != version
+}
+
+// the servers in a fixed pool that are being redialled in the background, and the connections to any that are back,
+// which connectServers picks up at the next turn boundary. both are guarded by workersMutex
+var redialing = make(map[string]bool)
+var redialed = make(map[string]*rpc.Client)
+
+// how long redialWorker waits before its first try, and the longest it waits between tries
+const firstRedialDelay = 100 * time.Millisecond
+const maxRedialDelay = 10 * time.Second
+
+// connectServers points servers at the given addresses, reusing any connections that are already open, or that have been redialled.
+// a server that can't be reached, or is still being redialled, is left as nil so its slice is processed elsewhere (see forgetWorker)
+func connectServers(addresses []string) {
+	connections := make(map[string]*rpc.Client)
+	for i, server := range servers {
+		if i < len(serverAddresses) && server != nil {
+			connections[serverAddresses[i]] = server
+		}
+	}
+
+	servers = make([]*rpc.Client, len(addresses))
+	for i, address := range addresses {
+		if server, ok := connections[address]; ok {
+			servers[i] = server
+			delete(connections, address)
+			continue
+		}
+		if server, down := redialState(address); server != nil || down {
+			servers[i] = server
+			continue
+		}
+		server, err := dialWorker(address)
+		if err != nil {
+			fmt.Println("Worker", address, "unreachable:", err)
+			forgetWorker(address)
+			continue
+		}
+		servers[i] = server
+	}
+	//close the connections to any servers that have left the pool
+	for _, server := range connections {
+		server.Close()
+	}
+	serverAddresses = addresses
+}
+
+// dialWorker connects to a server, giving up after workerTimeout so an unreachable machine doesn't hold up the batch
+func dialWorker(address string) (*rpc.Client, error) {
+	conn, err := net.DialTimeout("tcp", address, workerTimeout)
+	if err != nil {
+		return nil, err
+	}
+	return rpc.NewClient(conn), nil
+}
+
+// forgetWorker stops using a server that can't be reached or has failed. if servers register themselves, it is removed from the pool.
+// a fixed pool keeps it, and it is redialled in the background until it is back
+func forgetWorker(address string) {
+	if dynamicWorkers {
+		if deregisterWorker(address) {
+			fmt.Println("Worker", address, "dropped from the pool")
+		}
+		return
+	}
+
+	workersMutex.Lock()
+	defer workersMutex.Unlock()
+	if !redialing[address] {
+		fmt.Println("Worker", address, "will be redialled in the background")
+		redialing[address] = true
+		go redialWorker(address)
+	}
+}
+
+// redialWorker dials a server in a fixed pool until it is back, waiting twice as long after each try, up to maxRedialDelay.
+// once it is back, workersVersion is bumped so the turn loop rebalances onto it. it gives up if the server leaves the pool
+func redialWorker(address string) {
+	for delay := firstRedialDelay; ; delay *= 2 {
+		if delay > maxRedialDelay {
+			delay = maxRedialDelay
+		}
+		time.Sleep(delay)
+		server, err := dialWorker(address)
+
+		workersMutex.Lock()
+		inPool := false
+		for _, ip := range ips {
+			inPool = inPool || ip == address
+		}
+		if !inPool || err == nil {
+			delete(redialing, address)
+		}
+		if inPool && err == nil {
+			fmt.Println("Worker", address, "is back")
+			redialed[address] = server
+			workersVersion++
+		} else if err == nil {
+			server.Close()
+		}
+		workersMutex.Unlock()
+		if !inPool || err == nil {
+			return
+		}
+	}
+}
+
+// redialState returns the connection to a server that has been redialled since it failed, if it is back,
+// and whether it is still being redialled
+func redialState(address string) (*rpc.Client, bool) {
+	workersMutex.Lock()
+	defer workersMutex.Unlock()
+
+	server := redialed[address]
+	delete(redialed, address)
+	return server, redialing[address]
+}
+
+// dropServer stops using a failed server. closing its connection makes any call still in flight return
+func dropServer(i int) {
+	if servers[i] == nil {
+		return
+	}
+	fmt.Println("Worker", serverAddresses[i], "failed")
+	forgetWorker(serverAddresses[i])
+	servers[i].Close()
+	servers[i] = nil
+}
+
+// awaitCall waits for a call to a server to finish. it returns false if the call failed, timed out or was never made
+func awaitCall(call *rpc.Call) bool {
+	return awaitCallWithin(call, workerTimeout)
+}
+
+// awaitCallWithin is awaitCall with a different timeout, for calls that cover more than one turn
+func awaitCallWithin(call *rpc.Call, timeout time.Duration) bool {
+	if call == nil {
+		return false
+	}
+	select {
+	case <-call.Done:
+		return call.Error == nil
+	case <-time.After(timeout):
+		return false
+	}
+}
+
+// callSlice makes a non-blocking call asking a server to process the given number of turns of the slice described by req.
+// with halo exchange on, only the slice and the halo rows either side of it are sent rather than the whole world. the halo is the rule's radius
+// deep for each turn. with it off, turns is always 1, as runSession turns away sessions asking for more than one turn per batch
+func callSlice(server *rpc.Client, req *stubs.ServerRequest, res *stubs.ServerResponse, turns int) *rpc.Call {
+	if !haloExchange {
+		return server.Go(stubs.CalculateNextState, req, res, nil)
+	}
+	startIndex, endIndex := stubs.SliceBounds(req.ImageHeight, req.NoOfServers, req.ServerNumber)
+	boundary, _ := util.ParseBoundary(req.Boundary)
+	rule, _ := kernel.ParseRule(req.Rule)
+	sliceReq := stubs.SliceRequest{
+		Rows:     stubs.HaloRows(req.World, startIndex, endIndex, turns*rule.Radius, boundary),
+		Turns:    turns,
+		Rule:     req.Rule,
+		Boundary: req.Boundary,
+	}
+	return server.Go(stubs.CalculateNextSlice, sliceReq, res, nil)
+}
+
+// recalculateSlice processes a slice that a server failed on. every request carries the whole world and says which slice it is for,
+// so any surviving server can take it on. if none of them can, the broker processes the slice itself
+func recalculateSlice(req *stubs.ServerRequest, turns int) *stubs.ServerResponse {
+	for i, server := range servers {
+		if server == nil {
+			continue
+		}
+		res := new(stubs.ServerResponse)
+		if awaitCallWithin(callSlice(server, req, res, turns), workerTimeout*time.Duration(turns)) {
+			return res
+		}
+		dropServer(i)
+	}
+
+	//works the same way as CalculateNextSlice, eating the rule's radius in halo rows from each side per turn
+	startIndex, endIndex := stubs.SliceBounds(req.ImageHeight, req.NoOfServers, req.ServerNumber)
+	boundary, _ := util.ParseBoundary(req.Boundary)
+	rule, _ := kernel.ParseRule(req.Rule)
+	rows := stubs.HaloRows(req.World, startIndex, endIndex, turns*rule.Radius, boundary)
+	rowsChan := make(chan [][]uint64, 1)
+	for t := 0; t < turns; t++ {
+		kernel.UpdateCells(rows, rule.Radius, rows.Height-rule.Radius, rule, boundary, rowsChan)
+		rows = rows.WithRowsFrom(rule.Radius, <-rowsChan)
+	}
+	return &stubs.ServerResponse{World: rows}
+}
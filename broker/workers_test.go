@@ -0,0 +1,178 @@
+package main
+
+import (
+	"net/rpc"
+	"os"
+	"path/filepath"
+	"reflect"
+	"syscall"
+	"testing"
+	"time"
+
+	"uk.ac.bris.cs/gameoflife/stubs"
+)
+
+// TestLoadWorkers tests the -workers flag takes priority over GOL_WORKERS, which takes priority over the -config file, which takes priority
+// over the defaults, that blank lines, comments and spaces are skipped, and that an empty or missing list is an error
+func TestLoadWorkers(t *testing.T) {
+	dir := t.TempDir()
+	config := filepath.Join(dir, "workers.txt")
+	if err := os.WriteFile(config, []byte("# the lab machines\n10.0.0.1:8031\n\n  10.0.0.2:8031  \n#10.0.0.3:8031\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	empty := filepath.Join(dir, "empty.txt")
+	if err := os.WriteFile(empty, []byte("# nothing here\n\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		flag    string
+		env     string
+		config  string
+		workers []string
+		err     bool
+	}{
+		{name: "defaults", workers: defaultWorkers},
+		{name: "config", config: config, workers: []string{"10.0.0.1:8031", "10.0.0.2:8031"}},
+		{name: "env over config", env: "10.0.1.1:8031, 10.0.1.2:8031", config: config, workers: []string{"10.0.1.1:8031", "10.0.1.2:8031"}},
+		{name: "flag over env", flag: "10.0.2.1:8031,,10.0.2.2:8031,", env: "10.0.1.1:8031", config: config, workers: []string{"10.0.2.1:8031", "10.0.2.2:8031"}},
+		{name: "empty config", config: empty, err: true},
+		{name: "missing config", config: filepath.Join(dir, "missing.txt"), err: true},
+		{name: "empty flag", flag: " , ", err: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Setenv(workersEnv, test.env)
+			workers, err := loadWorkers(test.flag, test.config)
+			if test.err {
+				if err == nil {
+					t.Errorf("loadWorkers should have failed, but gave %v", workers)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(workers, test.workers) {
+				t.Errorf("loadWorkers gave %v, rather than %v", workers, test.workers)
+			}
+		})
+	}
+}
+
+// TestRedialWorker tests a server in a fixed pool that can't be reached is left out, rather than dialled again at every batch,
+// and is redialled in the background, so the next rebalance picks it up once it is started again
+func TestRedialWorker(t *testing.T) {
+	binary := buildCommand(t, "server")
+	address := freeAddress(t)
+	useWorkers([]string{address})
+
+	connectServers([]string{address})
+	if servers[0] != nil {
+		t.Fatal("a server that isn't running was connected to")
+	}
+	_, version := currentWorkers()
+	connectServers([]string{address})
+	if servers[0] != nil {
+		t.Fatal("a server that isn't running was connected to")
+	}
+
+	startServer(t, binary, address)
+	for start := time.Now(); !workersChanged(version); time.Sleep(10 * time.Millisecond) {
+		if time.Since(start) > 2*maxRedialDelay {
+			t.Fatal("the server wasn't redialled once it was started")
+		}
+	}
+	connectServers([]string{address})
+	if servers[0] == nil {
+		t.Fatal("the server wasn't picked up once it was redialled")
+	}
+	servers[0].Close()
+	servers = nil
+}
+
+// TestRegisterWorker tests servers registering with a -dynamic broker part way through a session, and deregistering part way through,
+// don't change the world it finishes on, and that a broker with a fixed pool turns servers away
+func TestRegisterWorker(t *testing.T) {
+	server := buildCommand(t, "server")
+	broker := buildCommand(t, "broker")
+
+	const turns = 3000
+	world := randomWorld(128, 128)
+	want := advanceWorld(world, turns)
+
+	tests := []struct {
+		engine string
+	}{
+		{engine: "stitch"},
+		{engine: "p2p"},
+	}
+	for _, test := range tests {
+		t.Run(test.engine, func(t *testing.T) {
+			address := freeAddress(t)
+			startBroker(t, broker, address, "-dynamic", "-advance", "10")
+			workers := make([]string, 3)
+			for i := range workers {
+				workers[i] = freeAddress(t)
+			}
+			startServer(t, server, workers[0], "-broker", address)
+			leaving := startServer(t, server, workers[1], "-broker", address)
+
+			client, err := rpc.Dial("tcp", address)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer client.Close()
+			res := new(stubs.Response)
+			call := client.Go(stubs.Broker, stubs.Request{ImageWidth: world.Width, ImageHeight: world.Height, Turns: turns, World: world,
+				Engine: test.engine}, res, nil)
+
+			// awaitBrokerTurn waits until the broker has completed the given turn
+			awaitBrokerTurn := func(turn int) {
+				for start := time.Now(); time.Since(start) < 30*time.Second; time.Sleep(time.Millisecond) {
+					alive := new(stubs.Response)
+					if err := client.Call(stubs.BrokerAliveCellHandler, stubs.Request{}, alive); err != nil {
+						t.Fatal(err)
+					}
+					if alive.CompletedTurns >= turn {
+						if alive.CompletedTurns >= turns {
+							t.Fatalf("the session finished before turn %v could be waited for", turn)
+						}
+						return
+					}
+				}
+				t.Fatalf("the session didn't reach turn %v", turn)
+			}
+			awaitBrokerTurn(turns / 4)
+			startServer(t, server, workers[2], "-broker", address)
+			awaitBrokerTurn(turns / 2)
+			leaving.Process.Signal(syscall.SIGTERM)
+			leaving.Wait()
+
+			<-call.Done
+			if call.Error != nil {
+				t.Fatal(call.Error)
+			}
+			if res.TerminateTurns != turns {
+				t.Fatalf("the session stopped on turn %v, rather than %v", res.TerminateTurns, turns)
+			}
+			sameWorld(t, res.World, want)
+		})
+	}
+
+	t.Run("fixed pool", func(t *testing.T) {
+		useWorkers([]string{"127.0.0.1:8031"})
+		for _, method := range []func(stubs.WorkerRequest, *stubs.WorkerResponse) error{
+			new(BrokerOperations).RegisterWorker,
+			new(BrokerOperations).DeregisterWorker,
+		} {
+			if err := method(stubs.WorkerRequest{Address: "127.0.0.1:8032"}, new(stubs.WorkerResponse)); err == nil {
+				t.Error("a broker with a fixed pool should turn servers away")
+			}
+		}
+		if workers, _ := currentWorkers(); !reflect.DeepEqual(workers, []string{"127.0.0.1:8031"}) {
+			t.Errorf("the fixed pool became %v", workers)
+		}
+	})
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"uk.ac.bris.cs/gameoflife/gol"
+	"uk.ac.bris.cs/gameoflife/util"
+)
+
+// TestCheckpoints tests checkpoints are written at least 500 turns apart in a run of 5000 turns on a 64x64 world, with the turn they are of
+// in their header and the world on that turn, checked against the kernel, that only the newest 3 are kept, and that the newest one resumes
+func TestCheckpoints(t *testing.T) {
+	p := gol.Params{ImageWidth: 64, ImageHeight: 64, Turns: 5000, Threads: 1, TurnsPerBatch: 10,
+		OutputDir: t.TempDir(), CheckpointTurns: 500, CheckpointKeep: 3}
+	events := make(chan gol.Event)
+	go gol.Run(p, events, nil)
+	var checkpoints []gol.CheckpointComplete
+	for event := range events {
+		if e, ok := event.(gol.CheckpointComplete); ok {
+			checkpoints = append(checkpoints, e)
+		}
+	}
+	if len(checkpoints) == 0 {
+		t.Fatal("no checkpoints were written")
+	}
+	for i := 1; i < len(checkpoints); i++ {
+		if checkpoints[i].CompletedTurns < checkpoints[i-1].CompletedTurns+500 {
+			t.Errorf("checkpoints were written on turns %d and %d, less than 500 apart", checkpoints[i-1].CompletedTurns, checkpoints[i].CompletedTurns)
+		}
+	}
+
+	files, err := os.ReadDir(filepath.Join(p.OutputDir, "checkpoints"))
+	util.Check(err)
+	if len(checkpoints) > 3 && len(files) != 3 {
+		t.Errorf("%d checkpoints are left of %d, rather than 3", len(files), len(checkpoints))
+	}
+
+	board := util.PackWorld(readWorld("images/64x64.pgm", 64, 64))
+	turn := 0
+	for _, checkpoint := range checkpoints {
+		board = advanceKernel(board, checkpoint.CompletedTurns-turn)
+		turn = checkpoint.CompletedTurns
+		path := filepath.Join(p.OutputDir, checkpoint.Filename)
+		if _, err := os.Stat(path); os.IsNotExist(err) {
+			continue
+		}
+		for _, line := range []string{fmt.Sprintf("turn %d", checkpoint.CompletedTurns), "turns 5000", "batch 10"} {
+			if !hasHeaderLine(path, line) {
+				t.Errorf("%v doesn't have %q in its header", checkpoint.Filename, line)
+			}
+		}
+		assertEqualGreys(t, readGreys(path, 64, 64), board.Unpack())
+	}
+
+	//the run carries on from its newest checkpoint to the same world it ended on
+	board = advanceKernel(board, p.Turns-turn)
+	resume := gol.Params{Turns: p.Turns, Threads: 1, OutputDir: t.TempDir(), Resume: filepath.Join(p.OutputDir, checkpoints[len(checkpoints)-1].Filename)}
+	resume, err = gol.WithInput(resume)
+	util.Check(err)
+	assertEqualBoard(t, runToEnd(t, resume).Alive, board.AliveCells(), resume)
+}
+
+// hasHeaderLine is whether a checkpoint has a line in its header
+func hasHeaderLine(path, line string) bool {
+	file, err := os.Open(path)
+	util.Check(err)
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() && scanner.Text() != "" {
+		if scanner.Text() == line {
+			return true
+		}
+	}
+	return false
+}
+
+// writeCheckpoint writes a world to a checkpoint with the header lines given, followed by the sha256 of its cells
+func writeCheckpoint(path string, header []string, world [][]byte) {
+	hash := sha256.New()
+	for _, row := range world {
+		hash.Write(row)
+	}
+	file, err := os.Create(path)
+	util.Check(err)
+	fmt.Fprintf(file, "GOL checkpoint\n%v\nsha256 %x\n\n", strings.Join(header, "\n"), hash.Sum(nil))
+	for _, row := range world {
+		_, err = file.Write(row)
+		util.Check(err)
+	}
+	util.Check(file.Close())
+}
+
+// TestResume tests resuming a 64x64 world from a checkpoint on turn 50 of each engine, which should carry on to turn 100 on the same engine,
+// with the final turn and the image written out at the end counting on from 50, and that checkpoints that don't fit the params are refused
+func TestResume(t *testing.T) {
+	board := advanceKernel(util.PackWorld(readWorld("images/64x64.pgm", 64, 64)), 50)
+	header := []string{"version 1", "engine stitch", "width 64", "height 64", "turn 50", "rule B3/S23", "boundary torus"}
+	dir := t.TempDir()
+	path := filepath.Join(dir, "64x64x50.checkpoint")
+	writeCheckpoint(path, header, board.Unpack())
+
+	for _, test := range []struct {
+		engine string
+	}{
+		{engine: "stitch"},
+		{engine: "p2p"},
+		{engine: "hashlife"},
+	} {
+		t.Run(test.engine, func(t *testing.T) {
+			emptyOutFolder()
+			path := filepath.Join(dir, test.engine+".checkpoint")
+			writeCheckpoint(path, append([]string{"version 1", "engine " + test.engine}, header[2:]...), board.Unpack())
+			p, err := gol.WithInput(gol.Params{Turns: 100, Threads: 1, Resume: path})
+			util.Check(err)
+			if p.StartTurn != 50 || p.ImageWidth != 64 || p.ImageHeight != 64 || p.Engine != test.engine {
+				t.Fatalf("WithInput read %v as %dx%d on turn %d of %q, rather than 64x64 on turn 50 of %q", path, p.ImageWidth, p.ImageHeight, p.StartTurn, p.Engine, test.engine)
+			}
+			final := runToEnd(t, p)
+			if final.CompletedTurns != 100 {
+				t.Errorf("the run resumed on turn 50 finished on turn %d, rather than 100", final.CompletedTurns)
+			}
+			assertEqualBoard(t, final.Alive, readAliveCells("check/images/64x64x100.pgm", 64, 64), p)
+			assertEqualGreys(t, readGreys("out/64x64x100.pgm", 64, 64), readGreys("check/images/64x64x100.pgm", 64, 64))
+		})
+	}
+
+	damaged := filepath.Join(dir, "damaged.checkpoint")
+	data, err := os.ReadFile(path)
+	util.Check(err)
+	data[len(data)-1] ^= 255
+	util.Check(os.WriteFile(damaged, data, 0644))
+	version := filepath.Join(dir, "version.checkpoint")
+	writeCheckpoint(version, append([]string{"version 2"}, header[1:]...), board.Unpack())
+	short := filepath.Join(dir, "short.checkpoint")
+	writeCheckpoint(short, header, board.Unpack()[:63])
+	noBoundary := filepath.Join(dir, "noboundary.checkpoint")
+	writeCheckpoint(noBoundary, header[:6], board.Unpack())
+	huge := filepath.Join(dir, "huge.checkpoint")
+	writeCheckpoint(huge, append([]string{"version 1", "engine stitch", "width 3000000000", "height 3000000000"}, header[4:]...), board.Unpack())
+
+	for _, test := range []struct {
+		name string
+		p    gol.Params
+	}{
+		{name: "damaged", p: gol.Params{Turns: 100, Resume: damaged}},
+		{name: "rule", p: gol.Params{Turns: 100, Resume: path, Rule: "B36/S23"}},
+		{name: "hex", p: gol.Params{Turns: 100, Resume: path, Neighbourhood: "hex"}},
+		{name: "boundary", p: gol.Params{Turns: 100, Resume: path, Boundary: "dead"}},
+		{name: "size", p: gol.Params{Turns: 100, Resume: path, ImageWidth: 512, ImageHeight: 512}},
+		{name: "width", p: gol.Params{Turns: 100, Resume: path, ImageWidth: 32}},
+		{name: "engine", p: gol.Params{Turns: 100, Resume: path, Engine: "p2p"}},
+		{name: "batch", p: gol.Params{Turns: 100, Resume: path, TurnsPerBatch: 7}},
+		{name: "turns", p: gol.Params{Turns: 10, Resume: path}},
+		{name: "input", p: gol.Params{Turns: 100, Resume: path, InputPath: "images/64x64.pgm"}},
+		{name: "not", p: gol.Params{Turns: 100, Resume: "images/64x64.pgm"}},
+		{name: "version", p: gol.Params{Turns: 100, Resume: version}},
+		{name: "short", p: gol.Params{Turns: 100, Resume: short}},
+		{name: "no boundary", p: gol.Params{Turns: 100, Resume: noBoundary}},
+		{name: "huge", p: gol.Params{Turns: 100, Resume: huge}},
+	} {
+		if _, err := gol.WithInput(test.p); err == nil {
+			t.Errorf("WithInput should have refused to resume for %v", test.name)
+		}
+	}
+	if _, err := gol.WithInput(gol.Params{Turns: 100, Resume: path, ImageWidth: 64, ImageHeight: 64, Engine: "stitch", Rule: "b3/s23", Boundary: "torus", Neighbourhood: "moore"}); err != nil {
+		t.Errorf("WithInput should have resumed with the size, engine, rule and boundary of the checkpoint given: %v", err)
+	}
+}
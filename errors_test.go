@@ -0,0 +1,66 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"uk.ac.bris.cs/gameoflife/gol"
+	"uk.ac.bris.cs/gameoflife/util"
+)
+
+// TestRunErrors tests a run that goes wrong sends a RunError event rather than panicking. a world that can't be read in, or that the broker
+// turns away, quits straight after it, while one that can't be written out still finishes
+func TestRunErrors(t *testing.T) {
+	truncated := filepath.Join(t.TempDir(), "truncated.pgm")
+	util.Check(os.WriteFile(truncated, append([]byte("P5\n16 16\n255\n"), make([]byte, 100)...), 0644))
+	notDir := filepath.Join(t.TempDir(), "file")
+	util.Check(os.WriteFile(notDir, []byte("not a folder"), 0644))
+
+	tests := []struct {
+		name     string
+		p        gol.Params
+		finished bool
+	}{
+		{name: "missing input", p: gol.Params{ImageWidth: 16, ImageHeight: 16, Turns: 1, InputPath: "images/missing.pgm"}},
+		{name: "truncated input", p: gol.Params{Turns: 1, InputPath: truncated}},
+		{name: "name template", p: gol.Params{ImageWidth: 16, ImageHeight: 16, Turns: 1, NameTemplate: "{turns}"}},
+		{name: "unknown engine", p: gol.Params{ImageWidth: 16, ImageHeight: 16, Turns: 1, Engine: "quantum"}},
+		{name: "hashlife without a torus", p: gol.Params{ImageWidth: 16, ImageHeight: 16, Turns: 1, Engine: "hashlife", Boundary: "dead"}},
+		{name: "unwritable output", p: gol.Params{ImageWidth: 16, ImageHeight: 16, Turns: 1, OutputDir: notDir}, finished: true},
+		{name: "unwritable checkpoint", p: gol.Params{ImageWidth: 16, ImageHeight: 16, Turns: 10, TurnsPerBatch: 1, CheckpointTurns: 5,
+			OutputDir: notDir}, finished: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			test.p.Threads = 1
+			events := make(chan gol.Event)
+			go gol.Run(test.p, events, nil)
+			var errors, finished, written int
+			var last gol.Event
+			for event := range events {
+				switch event.(type) {
+				case gol.RunError:
+					errors++
+				case gol.FinalTurnComplete:
+					finished++
+				case gol.ImageOutputComplete, gol.CheckpointComplete:
+					written++
+				}
+				last = event
+			}
+			if errors == 0 {
+				t.Error("no RunError event was sent")
+			}
+			if test.finished != (finished == 1) {
+				t.Errorf("%d FinalTurnComplete events were sent", finished)
+			}
+			if written != 0 {
+				t.Errorf("%d images and checkpoints were reported written, but nothing could be written", written)
+			}
+			if state, ok := last.(gol.StateChange); !ok || state.NewState != gol.Quitting {
+				t.Errorf("the last event was %v, rather than StateChange Quitting", last)
+			}
+		})
+	}
+}
@@ -0,0 +1,152 @@
+package gol
+
+import (
+	"fmt"
+	"net/rpc"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"uk.ac.bris.cs/gameoflife/kernel"
+	"uk.ac.bris.cs/gameoflife/stubs"
+	"uk.ac.bris.cs/gameoflife/util"
+)
+
+// checkpointDir is the folder inside the output folder checkpoints are written to
+const checkpointDir = "checkpoints"
+
+// checkpointPoll is how often the distributor checks whether a checkpoint is due
+const checkpointPoll = 100 * time.Millisecond
+
+// checkpointExt is the extension checkpoints are written with
+const checkpointExt = ".checkpoint"
+
+// defaultEngine is written as the engine of a checkpoint whose run left the broker to choose
+const defaultEngine = "default"
+
+// isCheckpoint is whether a path is to a checkpoint (see util.Checkpoint)
+func isCheckpoint(path string) bool {
+	return strings.EqualFold(filepath.Ext(path), checkpointExt)
+}
+
+// resumable makes sure a run with the params can carry on from the checkpoint. it has to be from this util.EngineVersion, and not past Turns,
+// and any size, engine, batch, rule, neighbourhood and boundary the params give have to be the ones it was run with
+func resumable(cp util.Checkpoint, p Params) error {
+	if cp.Version != util.EngineVersion {
+		return fmt.Errorf("%v was written by version %d of the engine, not this version, %d", p.Resume, cp.Version, util.EngineVersion)
+	}
+	if cp.Turn > p.Turns {
+		return fmt.Errorf("%v is on turn %d, past the %d turns asked for", p.Resume, cp.Turn, p.Turns)
+	}
+	width, height := p.ImageWidth, p.ImageHeight
+	if width == 0 {
+		width = cp.Width
+	}
+	if height == 0 {
+		height = cp.Height
+	}
+	if width != cp.Width || height != cp.Height {
+		return fmt.Errorf("%v is %dx%d, not the %dx%d asked for", p.Resume, cp.Width, cp.Height, width, height)
+	}
+	if p.Engine != "" && p.Engine != checkpointEngine(cp) {
+		return fmt.Errorf("%v was run on the %v engine, not %v", p.Resume, cp.Engine, p.Engine)
+	}
+	if p.TurnsPerBatch != 0 && p.TurnsPerBatch != cp.TurnsPerBatch {
+		return fmt.Errorf("%v was run %d turns per batch, not %d", p.Resume, cp.TurnsPerBatch, p.TurnsPerBatch)
+	}
+	given := p.Rule
+	if given == "" {
+		given = cp.Rule
+	}
+	rule, err := kernel.ParseRule(given)
+	if err != nil {
+		return err
+	}
+	if p.Neighbourhood != "" {
+		neighbourhood, err := kernel.ParseNeighbourhood(p.Neighbourhood)
+		if err != nil {
+			return err
+		}
+		if rule, err = rule.WithNeighbourhood(neighbourhood); err != nil {
+			return err
+		}
+	}
+	if rule.String() != cp.Rule {
+		return fmt.Errorf("%v was run with the rule %v, not %v", p.Resume, cp.Rule, rule)
+	}
+	if p.Boundary != "" {
+		boundary, err := util.ParseBoundary(p.Boundary)
+		if err != nil {
+			return err
+		}
+		if boundary.String() != cp.Boundary {
+			return fmt.Errorf("%v was run with a %v boundary, not %v", p.Resume, cp.Boundary, boundary)
+		}
+	}
+	return nil
+}
+
+// checkpointEngine is the engine a checkpoint was run on, which is empty for the broker's default
+func checkpointEngine(cp util.Checkpoint) string {
+	if cp.Engine == defaultEngine {
+		return ""
+	}
+	return cp.Engine
+}
+
+// checkpointer keeps track of the checkpoints the distributor has written in a run, so it knows when the next one is due and which to remove
+type checkpointer struct {
+	p        Params
+	rule     kernel.Rule
+	started  time.Time
+	lastTurn int
+	lastTime time.Time
+	written  []string
+}
+
+// check writes a checkpoint if CheckpointTurns turns or CheckpointInterval have passed since the last one. the broker only reports
+// CompletedTurns between batches, so checkpoints are at least CheckpointTurns apart rather than exactly on multiples of it.
+// a world that hasn't moved on since the last checkpoint, e.g. while paused, isn't written again
+func (cp *checkpointer) check(client *rpc.Client, req stubs.Request, c distributorChannels) {
+	res := new(stubs.Response)
+	if err := client.Call(stubs.BrokerAliveCellHandler, req, res); err != nil || res.CompletedTurns <= cp.lastTurn {
+		return
+	}
+	due := cp.p.CheckpointTurns > 0 && res.CompletedTurns >= cp.lastTurn+cp.p.CheckpointTurns ||
+		cp.p.CheckpointInterval > 0 && time.Since(cp.lastTime) >= cp.p.CheckpointInterval
+	if !due {
+		return
+	}
+	if err := client.Call(stubs.BrokerSaveCurrentState, req, res); err != nil {
+		return
+	}
+	cp.write(c, res.World.Unpack(), res.CompletedTurns)
+}
+
+// write sends the world to the io goroutine as a checkpoint, then has it remove the oldest checkpoints past CheckpointKeep
+func (cp *checkpointer) write(c distributorChannels, world [][]byte, turn int) {
+	filename := filepath.Join(checkpointDir, outputName(cp.p, cp.rule, turn, cp.started)+checkpointExt)
+	c.ioCommand <- ioCheckpoint
+	c.ioFilename <- filename
+	c.ioTurn <- turn
+	for i := 0; i < cp.p.ImageHeight; i++ {
+		for j := 0; j < cp.p.ImageWidth; j++ {
+			c.ioOutput <- world[i][j]
+		}
+	}
+	cp.lastTurn, cp.lastTime = turn, time.Now()
+
+	//a name template without {turn} writes each checkpoint over the last, which is still only one checkpoint
+	if len(cp.written) == 0 || cp.written[len(cp.written)-1] != filename {
+		cp.written = append(cp.written, filename)
+	}
+	for cp.p.CheckpointKeep > 0 && len(cp.written) > cp.p.CheckpointKeep {
+		c.ioCommand <- ioRemove
+		c.ioFilename <- cp.written[0]
+		cp.written = cp.written[1:]
+	}
+
+	if awaitIo(c, turn) {
+		c.events <- CheckpointComplete{CompletedTurns: turn, Filename: filename}
+	}
+}
@@ -2,10 +2,11 @@ package gol
 
 import (
 	"net/rpc"
-	"strconv"
 	"time"
 
+	"uk.ac.bris.cs/gameoflife/kernel"
 	"uk.ac.bris.cs/gameoflife/stubs"
+	"uk.ac.bris.cs/gameoflife/util"
 )
 
 type distributorChannels struct {
@@ -13,12 +14,16 @@ type distributorChannels struct {
 	ioCommand  chan<- ioCommand
 	ioIdle     <-chan bool
 	ioFilename chan<- string
+	ioTurn     chan<- int
 	ioOutput   chan<- uint8
 	ioInput    <-chan uint8
+	ioErrors   <-chan error
 }
 
 // distributor divides the work between workers and interacts with other goroutines.
 func distributor(p Params, c distributorChannels, keyPresses <-chan rune) {
+	//stops the io goroutine however the run ends
+	defer close(c.ioCommand)
 
 	//Create a 2D slice to store the world.
 	world := make([][]byte, p.ImageHeight)
@@ -26,36 +31,61 @@ func distributor(p Params, c distributorChannels, keyPresses <-chan rune) {
 		world[i] = make([]byte, p.ImageWidth)
 	}
 
-	//creates the filename based on the width and height parameters
-	filename := strconv.Itoa(p.ImageHeight) + "x" + strconv.Itoa(p.ImageWidth)
+	//the time the run started, which the names of all its images have as their timestamp
+	started := time.Now()
 
 	//tells the command channel that we are ready to accept input
 	c.ioCommand <- ioInput
-	//provides the readPGM function the filename
-	c.ioFilename <- filename
+	//provides the readPGM function the path of the image
+	c.ioFilename <- inputPath(p)
 
-	//copies the starting world byte by byte from the input PGM image
+	//copies the starting world byte by byte from the input PGM image, unless it can't be read
 	for i := range world {
 		for j := range world[i] {
-			world[i][j] = <-c.ioInput
+			select {
+			case world[i][j] = <-c.ioInput:
+			case err := <-c.ioErrors:
+				quit(c.events, p.StartTurn, err)
+				return
+			}
 		}
 	}
 
-	turn := 0
+	//packs the world one bit per cell (in more than one bit plane for a Generations rule), and it is unpacked again when it is written out
+	rule, err := kernel.ParseRule(p.Rule)
+	if err != nil {
+		quit(c.events, p.StartTurn, err)
+		return
+	}
+	board := util.PackStates(world, rule.States)
+
+	turn := p.StartTurn
 	c.events <- StateChange{turn, Executing}
 
 	//execute all turns of the Game of Life
 
 	//requests a tcp connection with the server running on AWS node.
-	client, _ := rpc.Dial("tcp", "127.0.0.1:8030")
+	client, err := rpc.Dial("tcp", "127.0.0.1:8030")
+	if err != nil {
+		quit(c.events, turn, err)
+		return
+	}
 	defer client.Close()
 
 	// creates a request to be sent to the server to process GOL
 	req := stubs.Request{
-		ImageWidth:  p.ImageWidth,
-		ImageHeight: p.ImageHeight,
-		Turns:       p.Turns,
-		World:       world,
+		ImageWidth:    p.ImageWidth,
+		ImageHeight:   p.ImageHeight,
+		Turns:         p.Turns,
+		World:         board,
+		Engine:        p.Engine,
+		TurnsPerBatch: p.TurnsPerBatch,
+		Rule:          p.Rule,
+		Boundary:      p.Boundary,
+		Neighbourhood: p.Neighbourhood,
+		StartTurn:     p.StartTurn,
+		//the time the run started tells its session apart from any other client's
+		Session: started.UnixNano(),
 	}
 
 	// creates a response to hold GoL attributes
@@ -69,6 +99,15 @@ func distributor(p Params, c distributorChannels, keyPresses <-chan rune) {
 	//creates a new ticker to sound every two seconds
 	ticker := time.NewTicker(2 * time.Second)
 
+	//checks whether a checkpoint is due every checkpointPoll, if the params ask for them
+	checkpoints := checkpointer{p: p, rule: rule, started: started, lastTurn: p.StartTurn, lastTime: started}
+	var checkpointTicks <-chan time.Time
+	if p.CheckpointTurns > 0 || p.CheckpointInterval > 0 {
+		checkpointTicker := time.NewTicker(checkpointPoll)
+		defer checkpointTicker.Stop()
+		checkpointTicks = checkpointTicker.C
+	}
+
 	// momentarily pauses to give time for game to initialise
 	// as un-paused and not terminating
 	time.Sleep(10 * time.Millisecond)
@@ -90,14 +129,17 @@ func distributor(p Params, c distributorChannels, keyPresses <-chan rune) {
 				CellsCount:     res.NumAliveCells,
 			}
 
+		case <-checkpointTicks:
+			checkpoints.check(client, req, c)
+
 		case keyPressed := <-keyPresses:
 
 			if keyPressed == 's' {
 				client.Call(stubs.BrokerSaveCurrentState, req, res)
 
-				currentStateFileName := filename + "x" + strconv.Itoa(res.CompletedTurns)
+				currentStateFileName := outputName(p, rule, res.CompletedTurns, started)
 
-				makeOutputPGM(p, c, res.World, currentStateFileName, res.CompletedTurns)
+				makeOutputPGM(p, c, res.World.Unpack(), currentStateFileName, res.CompletedTurns)
 
 			} else if keyPressed == 'q' {
 				// close client without affecting the server
@@ -128,18 +170,22 @@ func distributor(p Params, c distributorChannels, keyPresses <-chan rune) {
 	}
 
 	ticker.Stop()
+	//the broker turns away sessions it can't run, e.g. with an engine it doesn't have
+	if runGol.Error != nil {
+		quit(c.events, turn, runGol.Error)
+		return
+	}
 
 	// reports the final state using FinalTurnCompleteEvent
 	c.events <- FinalTurnComplete{CompletedTurns: res.TerminateTurns, Alive: res.AliveCells}
 
 	//updates filename for the final output PGM
-	finalOutFileName := filename + "x" + strconv.Itoa(res.TerminateTurns)
+	finalOutFileName := outputName(p, rule, res.TerminateTurns, started)
 
-	makeOutputPGM(p, c, res.World, finalOutFileName, res.TerminateTurns)
+	makeOutputPGM(p, c, res.World.Unpack(), finalOutFileName, res.TerminateTurns)
 
 	// Make sure that the Io has finished any output before exiting.
-	c.ioCommand <- ioCheckIdle
-	<-c.ioIdle
+	awaitIo(c, res.TerminateTurns)
 
 	c.events <- StateChange{res.TerminateTurns, Quitting}
 
@@ -147,22 +193,47 @@ func distributor(p Params, c distributorChannels, keyPresses <-chan rune) {
 	close(c.events)
 }
 
+// makeOutputPGM writes the world out in each of the output formats, with the filename and the format's extension
 func makeOutputPGM(p Params, c distributorChannels, world [][]byte, filename string, completedTurns int) {
-	//signals that we are ready to create an output file
-	c.ioCommand <- ioOutput
-	//sends the output filename down the filename channel
-	c.ioFilename <- filename
-
-	//sends the output of the final world byte by byte down the output channel
-	for i := 0; i < p.ImageHeight; i++ {
-		for j := 0; j < p.ImageWidth; j++ {
-			c.ioOutput <- world[i][j]
+	for _, format := range outputFormats(p) {
+		//signals that we are ready to create an output file
+		c.ioCommand <- ioOutput
+		//sends the output filename down the filename channel
+		c.ioFilename <- filename + "." + format
+
+		//sends the output of the final world byte by byte down the output channel
+		for i := 0; i < p.ImageHeight; i++ {
+			for j := 0; j < p.ImageWidth; j++ {
+				c.ioOutput <- world[i][j]
+			}
 		}
 	}
 
 	// Make sure that the Io has finished any output before exiting.
+	if awaitIo(c, completedTurns) {
+		c.events <- ImageOutputComplete{CompletedTurns: completedTurns, Filename: filename}
+	}
+}
+
+// awaitIo waits for the io goroutine to finish what it has been asked to do, reporting anything it couldn't write out.
+// the run carries on without it. it returns false if anything couldn't be written
+func awaitIo(c distributorChannels, completedTurns int) bool {
 	c.ioCommand <- ioCheckIdle
-	<-c.ioIdle
+	written := true
+	for {
+		select {
+		case err := <-c.ioErrors:
+			c.events <- RunError{CompletedTurns: completedTurns, Err: err}
+			written = false
+		case <-c.ioIdle:
+			return written
+		}
+	}
+}
 
-	c.events <- ImageOutputComplete{CompletedTurns: completedTurns, Filename: filename}
+// quit reports a problem the run can't carry on from, and ends it
+func quit(events chan<- Event, completedTurns int, err error) {
+	events <- RunError{CompletedTurns: completedTurns, Err: err}
+	events <- StateChange{completedTurns, Quitting}
+	close(events)
 }
@@ -29,6 +29,20 @@ type ImageOutputComplete struct { // implements Event
 	Filename       string
 }
 
+// `CheckpointComplete` is an Event notifying the user that a checkpoint of the world has been written.
+// This Event is sent every time a checkpoint has been saved, if the params ask for them.
+type CheckpointComplete struct { // implements Event
+	CompletedTurns int
+	Filename       string
+}
+
+// `RunError` is an Event notifying the user of something that went wrong, such as an image that couldn't be read or written.
+// A run that can't carry on sends StateChange Quitting straight after it.
+type RunError struct { // implements Event
+	CompletedTurns int
+	Err            error
+}
+
 // State represents a change in the state of execution.
 type State int
 
@@ -48,6 +62,8 @@ type StateChange struct { // implements Event
 // `CellFlipped` is an Event notifying the GUI about a change of state of a single cell.
 // This event should be sent every time a cell changes state.
 // Make sure to send this event for all cells that are alive when the image is loaded in.
+// With a Generations rule, only state 1 counts as alive, so a cell flips when it is born and when it starts dying.
+// Moving from one dying state to the next, or from the last one to dead, isn't a flip.
 type CellFlipped struct { // implements Event
 	CompletedTurns int
 	Cell           util.Cell
@@ -117,6 +133,22 @@ func (event ImageOutputComplete) GetCompletedTurns() int {
 	return event.CompletedTurns
 }
 
+func (event CheckpointComplete) String() string {
+	return fmt.Sprintf("Checkpoint %v Done", event.Filename)
+}
+
+func (event CheckpointComplete) GetCompletedTurns() int {
+	return event.CompletedTurns
+}
+
+func (event RunError) String() string {
+	return fmt.Sprintf("Error: %v", event.Err)
+}
+
+func (event RunError) GetCompletedTurns() int {
+	return event.CompletedTurns
+}
+
 func (event CellFlipped) String() string {
 	return ""
 }
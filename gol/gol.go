@@ -1,30 +1,93 @@
 package gol
 
+import (
+	"time"
+)
+
 // Params provides the details of how to run the Game of Life and which image to load.
 type Params struct {
 	Turns       int
 	Threads     int
 	ImageWidth  int
 	ImageHeight int
+
+	// Engine is how the broker runs the turns: "stitch", "p2p" or "hashlife". empty uses the broker's default
+	Engine string
+	// TurnsPerBatch is how many turns the servers process per call, and so how often CompletedTurns moves on. 0 uses the engine's default
+	TurnsPerBatch int
+
+	// Rule is in B/S notation (B36/S23), B/S/C for Generations (B2/S/C3), Larger than Life notation (R5,C0,M1,S34..58,B34..45,NM)
+	// or the name of a table in the rules folder (see kernel.Table). empty uses B3/S23
+	Rule string
+	// Boundary is what lies past the edges of the world: "torus", "dead", "klein" or "mirror". empty uses torus
+	Boundary string
+	// Neighbourhood is which cells around a cell count: "moore", "vonneumann" or "hex". empty uses the rule's own.
+	// hex needs a dead boundary, or a torus with an even height
+	Neighbourhood string
+
+	// InputPath is the image, checkpoint or pattern to start from (see WithInput). empty uses images/<ImageHeight>x<ImageWidth>.pgm
+	InputPath string
+	// OutputFormats are the formats the world is written out in, out of Formats. empty writes pgm and rle
+	OutputFormats []string
+	// Scale is how many pixels across each cell is in a PNG image. 0 uses 1
+	Scale int
+	// OutputDir is the folder the world is written out to. empty uses out
+	OutputDir string
+	// NameTemplate is the name the world is written out under, with {width}, {height}, {turn}, {timestamp} and {rule} filled in.
+	// a / in it writes to a folder inside OutputDir. empty uses DefaultNameTemplate
+	NameTemplate string
+
+	// CheckpointTurns and CheckpointInterval are how often a checkpoint is written to OutputDir/checkpoints. 0 doesn't
+	CheckpointTurns    int
+	CheckpointInterval time.Duration
+	// CheckpointKeep is how many of a run's newest checkpoints are kept. 0 keeps them all
+	CheckpointKeep int
+	// Resume is a checkpoint to carry on from. WithInput reads the size, engine, batch, StartTurn, rule and boundary from it
+	Resume string
+	// StartTurn is the turn the world starts on, which CompletedTurns and the output names carry on from
+	StartTurn int
+}
+
+// Formats are the file extensions of the formats the world can be written out in
+var Formats = []string{"pgm", "rle", "cells", "lif", "png"}
+
+// outputFormats are the formats the world is written out in
+func outputFormats(p Params) []string {
+	if len(p.OutputFormats) == 0 {
+		return []string{"pgm", "rle"}
+	}
+	return p.OutputFormats
 }
 
 // Run starts the processing of Game of Life. It should initialise channels and goroutines.
 func Run(p Params, events chan<- Event, keyPresses <-chan rune) {
+	p, err := WithInput(p)
+	if err == nil {
+		err = CheckNameTemplate(p.NameTemplate)
+	}
+	if err != nil {
+		quit(events, p.StartTurn, err)
+		return
+	}
 
 	//	TODO: Put the missing channels in here.
 
 	ioCommand := make(chan ioCommand)
 	ioIdle := make(chan bool)
 	ioFilename := make(chan string)
+	ioTurn := make(chan int)
 	ioOutput := make(chan uint8)
 	ioInput := make(chan uint8)
+	ioErrors := make(chan error)
 
 	ioChannels := ioChannels{
 		command:  ioCommand,
 		idle:     ioIdle,
 		filename: ioFilename,
+		turn:     ioTurn,
 		output:   ioOutput,
 		input:    ioInput,
+		errors:   ioErrors,
 	}
 	go startIo(p, ioChannels)
 
@@ -33,8 +96,10 @@ func Run(p Params, events chan<- Event, keyPresses <-chan rune) {
 		ioCommand:  ioCommand,
 		ioIdle:     ioIdle,
 		ioFilename: ioFilename,
+		ioTurn:     ioTurn,
 		ioOutput:   ioOutput,
 		ioInput:    ioInput,
+		ioErrors:   ioErrors,
 	}
 	distributor(p, distributorChannels, keyPresses)
 }
@@ -3,8 +3,10 @@ package gol
 import (
 	"fmt"
 	"os"
+	"path/filepath"
 	"strconv"
 	"strings"
+	"uk.ac.bris.cs/gameoflife/kernel"
 	"uk.ac.bris.cs/gameoflife/util"
 )
 
@@ -13,14 +15,19 @@ type ioChannels struct {
 	idle    chan<- bool
 
 	filename <-chan string
+	turn     <-chan int
 	output   <-chan uint8
 	input    chan<- uint8
+	errors   chan<- error
 }
 
 // ioState is the internal ioState of the io goroutine.
 type ioState struct {
 	params   Params
 	channels ioChannels
+
+	//images and checkpoints that couldn't be written, which are reported the next time the distributor checks the goroutine is idle
+	errs []error
 }
 
 // ioCommand allows requesting behaviour from the io (pgm) goroutine.
@@ -31,97 +38,290 @@ type ioCommand uint8
 //		ioOutput 	= 0
 //		ioInput 	= 1
 //		ioCheckIdle = 2
+//		ioCheckpoint = 3
+//		ioRemove 	= 4
 const (
 	ioOutput ioCommand = iota
 	ioInput
 	ioCheckIdle
+	ioCheckpoint
+	ioRemove
 )
 
-// writePgmImage receives an array of bytes and writes it to a pgm file.
-func (io *ioState) writePgmImage() {
-	_ = os.Mkdir("out", os.ModePerm)
-
+// writeImage receives an array of bytes and writes it to a file in the format its extension says: pgm, rle, cells, lif (Life 1.06) or png.
+func (io *ioState) writeImage() error {
 	// Request a filename from the distributor.
 	filename := <-io.channels.filename
+	path := filepath.Join(outputDir(io.params), filename)
 
-	file, ioError := os.Create("out/" + filename + ".pgm")
-	util.Check(ioError)
-	defer file.Close()
+	world := io.receiveWorld()
 
-	_, _ = file.WriteString("P5\n")
-	//_, _ = file.WriteString("# PGM file writer by pnmmodules (https://github.com/owainkenwayucl/pnmmodules).\n")
-	_, _ = file.WriteString(strconv.Itoa(io.params.ImageWidth))
-	_, _ = file.WriteString(" ")
-	_, _ = file.WriteString(strconv.Itoa(io.params.ImageHeight))
-	_, _ = file.WriteString("\n")
-	_, _ = file.WriteString(strconv.Itoa(255))
-	_, _ = file.WriteString("\n")
+	if ioError := os.MkdirAll(filepath.Dir(path), os.ModePerm); ioError != nil {
+		return ioError
+	}
+	rule, ioError := kernel.ParseRule(io.params.Rule)
+	if ioError != nil {
+		return ioError
+	}
 
-	world := make([][]byte, io.params.ImageHeight)
-	for i := range world {
-		world[i] = make([]byte, io.params.ImageWidth)
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".pgm":
+		ioError = writePgm(path, world)
+	case ".rle":
+		ioError = writeRle(path, world, rule)
+	case ".cells":
+		ioError = writeCells(path, world, rule)
+	case ".lif":
+		ioError = writeLife106(path, world, rule)
+	case ".png":
+		ioError = writePng(path, world, io.params.Scale)
+	default:
+		ioError = fmt.Errorf("%v can't be written, as %q isn't a format that can be written", filename, filepath.Ext(filename))
+	}
+	if ioError != nil {
+		return ioError
 	}
 
-	for y := 0; y < io.params.ImageHeight; y++ {
-		for x := 0; x < io.params.ImageWidth; x++ {
-			val := <-io.channels.output
-			//if val != 0 {
-			//	fmt.Println(x, y)
-			//}
-			world[y][x] = val
+	fmt.Println("File", filename, "output done!")
+	return nil
+}
+
+// writeCheckpoint receives the turn and an array of bytes, and writes them to a checkpoint, with the rule, boundary, engine and turns of the run
+func (io *ioState) writeCheckpoint() error {
+	filename := <-io.channels.filename
+	turn := <-io.channels.turn
+	path := filepath.Join(outputDir(io.params), filename)
+
+	world := io.receiveWorld()
+
+	if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+		return err
+	}
+	//the rule is written with the neighbourhood it is run with, so resuming from it doesn't need the neighbourhood given again
+	rule, err := kernel.ParseRule(io.params.Rule)
+	if err != nil {
+		return err
+	}
+	if io.params.Neighbourhood != "" {
+		neighbourhood, err := kernel.ParseNeighbourhood(io.params.Neighbourhood)
+		if err != nil {
+			return err
 		}
+		if rule, err = rule.WithNeighbourhood(neighbourhood); err != nil {
+			return err
+		}
+	}
+	boundary, err := util.ParseBoundary(io.params.Boundary)
+	if err != nil {
+		return err
+	}
+	engine := io.params.Engine
+	if engine == "" {
+		engine = defaultEngine
+	}
+	return util.WriteCheckpoint(path, util.Checkpoint{
+		Version:       util.EngineVersion,
+		Engine:        engine,
+		Width:         io.params.ImageWidth,
+		Height:        io.params.ImageHeight,
+		Turn:          turn,
+		Turns:         io.params.Turns,
+		TurnsPerBatch: io.params.TurnsPerBatch,
+		Rule:          rule.String(),
+		Boundary:      boundary.String(),
+		World:         world,
+	})
+}
+
+// removeImage removes an image from the output folder, which is fine if it has already gone
+func (io *ioState) removeImage() error {
+	filename := <-io.channels.filename
+	if err := os.Remove(filepath.Join(outputDir(io.params), filename)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// receiveWorld receives the world from the distributor byte by byte
+func (io *ioState) receiveWorld() [][]byte {
+	world := make([][]byte, io.params.ImageHeight)
+	for i := range world {
+		world[i] = make([]byte, io.params.ImageWidth)
 	}
 
 	for y := 0; y < io.params.ImageHeight; y++ {
 		for x := 0; x < io.params.ImageWidth; x++ {
-			_, ioError = file.Write([]byte{world[y][x]})
-			util.Check(ioError)
+			world[y][x] = <-io.channels.output
 		}
 	}
-
-	ioError = file.Sync()
-	util.Check(ioError)
-
-	fmt.Println("File", filename, "output done!")
+	return world
 }
 
-// readPgmImage opens a pgm file and sends its data as an array of bytes.
-func (io *ioState) readPgmImage() {
+// readImage opens a pgm file (raw or plain, with any maxval), a png image, a checkpoint, or an rle, cells or Life 1.06 pattern, and sends its data as an array of bytes.
+// a pattern is placed in the middle of a world of the size in the params. if it can't be read, the distributor is sent the error instead
+// of the rest of the bytes
+func (io *ioState) readImage() error {
 
-	// Request a filename from the distributor.
-	filename := <-io.channels.filename
+	// Request a path from the distributor.
+	path := <-io.channels.filename
 
-	data, ioError := os.ReadFile("images/" + filename + ".pgm")
-	util.Check(ioError)
+	if pattern, ok, ioError := readPattern(path); ok {
+		if ioError != nil {
+			return ioError
+		}
+		rule, ioError := kernel.ParseRule(io.params.Rule)
+		if ioError != nil {
+			return ioError
+		}
+		world, ioError := pattern.place(io.params.ImageWidth, io.params.ImageHeight, rule.States)
+		if ioError != nil {
+			return ioError
+		}
+		io.sendWorld(world)
+	} else if isPng(path) || isCheckpoint(path) {
+		world, ioError := readWholeWorld(path)
+		if ioError != nil {
+			return ioError
+		}
+		if len(world) != io.params.ImageHeight || len(world[0]) != io.params.ImageWidth {
+			return fmt.Errorf("%v is %dx%d, but the world is %dx%d", path, len(world[0]), len(world), io.params.ImageWidth, io.params.ImageHeight)
+		}
+		io.sendWorld(world)
+	} else {
+		file, ioError := os.Open(path)
+		if ioError != nil {
+			return ioError
+		}
+		defer file.Close()
+		pgm, ioError := newPgmReader(path, file)
+		if ioError != nil {
+			return ioError
+		}
+		if pgm.header.width != io.params.ImageWidth || pgm.header.height != io.params.ImageHeight {
+			return fmt.Errorf("%v is %dx%d, but the world is %dx%d", path, pgm.header.width, pgm.header.height, io.params.ImageWidth, io.params.ImageHeight)
+		}
+		//the grey levels are sent on as they are read, so the whole file is never held at once
+		if ioError := pgm.each(func(b byte) { io.channels.input <- b }); ioError != nil {
+			return ioError
+		}
+	}
 
-	fields := strings.Fields(string(data))
+	fmt.Println("File", path, "input done!")
+	return nil
+}
 
-	if fields[0] != "P5" {
-		panic("Not a pgm file")
+// sendWorld sends a world that has been read in to the distributor byte by byte
+func (io *ioState) sendWorld(world [][]byte) {
+	for _, row := range world {
+		for _, b := range row {
+			io.channels.input <- b
+		}
 	}
+}
 
-	width, _ := strconv.Atoi(fields[1])
-	if width != io.params.ImageWidth {
-		panic("Incorrect width")
+// readPattern reads a pattern from an rle, cells or Life 1.06 (lif or life) file, chosen by its extension.
+// ok is false for any other file, which is a pgm image
+func readPattern(path string) (p pattern, ok bool, err error) {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".rle":
+		p, err = readRle(path)
+	case ".cells":
+		p, err = readCells(path)
+	case ".lif", ".life":
+		p, err = readLife106(path)
+	default:
+		return pattern{}, false, nil
 	}
+	return p, true, err
+}
 
-	height, _ := strconv.Atoi(fields[2])
-	if height != io.params.ImageHeight {
-		panic("Incorrect height")
+// WithInput returns the params with what the image they start from says about the world. with the InputPath of a pgm or png image,
+// ImageWidth and ImageHeight are read from it. otherwise images/<ImageHeight>x<ImageWidth>.pgm has to exist and be the size they already say.
+// a pattern is placed in a world of the size they already say, so it has to fit, and the rule of an rle pattern is used if the params don't give one.
+// a checkpoint can be started from like an image. resuming from one reads it in as the InputPath, starting on its turn with its size, engine, batch,
+// rule, neighbourhood and boundary, which the params have to match if they give them (see checkpoint.resumable)
+func WithInput(p Params) (Params, error) {
+	if p.Resume != "" {
+		if p.InputPath != "" && p.InputPath != p.Resume {
+			return p, fmt.Errorf("a run can't both resume from %v and start from %v", p.Resume, p.InputPath)
+		}
+		cp, err := util.ReadCheckpoint(p.Resume)
+		if err != nil {
+			return p, err
+		}
+		if err := resumable(cp, p); err != nil {
+			return p, err
+		}
+		p.InputPath = p.Resume
+		p.ImageWidth, p.ImageHeight = cp.Width, cp.Height
+		p.Engine, p.TurnsPerBatch = checkpointEngine(cp), cp.TurnsPerBatch
+		p.StartTurn = cp.Turn
+		p.Rule, p.Boundary, p.Neighbourhood = cp.Rule, cp.Boundary, ""
+		return p, nil
 	}
+	path := inputPath(p)
+	if pattern, ok, err := readPattern(path); ok {
+		if err != nil {
+			return p, err
+		}
+		if _, _, err := pattern.corner(p.ImageWidth, p.ImageHeight); err != nil {
+			return p, fmt.Errorf("%v: %v", path, err)
+		}
+		if p.Rule == "" {
+			p.Rule = pattern.Rule
+		}
+		return p, nil
+	}
+	if isCheckpoint(path) {
+		cp, err := util.ReadCheckpoint(path)
+		if err != nil {
+			return p, err
+		}
+		p.ImageWidth, p.ImageHeight = cp.Width, cp.Height
+		return p, nil
+	}
+	if isPng(path) {
+		world, err := readPng(path)
+		if err != nil {
+			return p, err
+		}
+		if len(world) == 0 || len(world[0]) == 0 {
+			return p, fmt.Errorf("%v has no pixels", path)
+		}
+		p.ImageWidth, p.ImageHeight = len(world[0]), len(world)
+		return p, nil
+	}
+	header, err := checkPgm(path)
+	if err != nil {
+		return p, err
+	}
+	if p.InputPath == "" && (header.width != p.ImageWidth || header.height != p.ImageHeight) {
+		return p, fmt.Errorf("%v is %dx%d, not the %dx%d asked for", path, header.width, header.height, p.ImageWidth, p.ImageHeight)
+	}
+	p.ImageWidth, p.ImageHeight = header.width, header.height
+	return p, nil
+}
 
-	maxval, _ := strconv.Atoi(fields[3])
-	if maxval != 255 {
-		panic("Incorrect maxval/bit depth")
+// readWholeWorld reads a png image or a checkpoint, which are read all at once rather than streamed like a pgm file
+func readWholeWorld(path string) ([][]byte, error) {
+	if isCheckpoint(path) {
+		cp, err := util.ReadCheckpoint(path)
+		return cp.World, err
 	}
+	return readPng(path)
+}
 
-	image := []byte(fields[4])
+// isPng is whether a path is to a png image
+func isPng(path string) bool {
+	return strings.EqualFold(filepath.Ext(path), ".png")
+}
 
-	for _, b := range image {
-		io.channels.input <- b
+// inputPath is the image the world is loaded from
+func inputPath(p Params) string {
+	if p.InputPath != "" {
+		return p.InputPath
 	}
-
-	fmt.Println("File", filename, "input done!")
+	return "images/" + strconv.Itoa(p.ImageHeight) + "x" + strconv.Itoa(p.ImageWidth) + ".pgm"
 }
 
 // startIo should be the entrypoint of the io goroutine.
@@ -135,11 +335,29 @@ func startIo(p Params, c ioChannels) {
 		// Block and wait for requests from the distributor
 		switch command {
 		case ioInput:
-			io.readPgmImage()
+			//the distributor is waiting on the world, so an image that can't be read is reported straight away
+			if err := io.readImage(); err != nil {
+				io.channels.errors <- err
+			}
 		case ioOutput:
-			io.writePgmImage()
+			io.keep(io.writeImage())
 		case ioCheckIdle:
+			for _, err := range io.errs {
+				io.channels.errors <- err
+			}
+			io.errs = nil
 			io.channels.idle <- true
+		case ioCheckpoint:
+			io.keep(io.writeCheckpoint())
+		case ioRemove:
+			io.keep(io.removeImage())
 		}
 	}
 }
+
+// keep holds on to an error from writing out, until the distributor next checks the goroutine is idle
+func (io *ioState) keep(err error) {
+	if err != nil {
+		io.errs = append(io.errs, err)
+	}
+}
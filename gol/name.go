@@ -0,0 +1,65 @@
+package gol
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"time"
+
+	"uk.ac.bris.cs/gameoflife/kernel"
+)
+
+// DefaultNameTemplate is the name the world is written out under when the params don't give one, e.g. 512x512x100
+const DefaultNameTemplate = "{height}x{width}x{turn}"
+
+// timestampLayout is how {timestamp} is written, which sorts in the order the runs started and has nothing a filename can't
+const timestampLayout = "20060102-150405"
+
+var (
+	placeholder  = regexp.MustCompile(`{[^{}]*}`)
+	unsafeInName = regexp.MustCompile(`[^A-Za-z0-9.-]`)
+)
+
+// CheckNameTemplate makes sure a name template only has the placeholders {width}, {height}, {turn}, {timestamp} and {rule} in it
+func CheckNameTemplate(template string) error {
+	for _, name := range placeholder.FindAllString(template, -1) {
+		switch name {
+		case "{width}", "{height}", "{turn}", "{timestamp}", "{rule}":
+		default:
+			return fmt.Errorf("the name template %q has %v in it, which isn't one of {width}, {height}, {turn}, {timestamp} or {rule}", template, name)
+		}
+	}
+	return nil
+}
+
+// outputName fills in the name template of the params for the world on a turn, with the time the run started as its timestamp.
+// the rule is written with anything other than letters, digits, dots and dashes as a dash, so B3/S23 is B3-S23
+func outputName(p Params, rule kernel.Rule, turn int, started time.Time) string {
+	template := p.NameTemplate
+	if template == "" {
+		template = DefaultNameTemplate
+	}
+	return placeholder.ReplaceAllStringFunc(template, func(name string) string {
+		switch name {
+		case "{width}":
+			return strconv.Itoa(p.ImageWidth)
+		case "{height}":
+			return strconv.Itoa(p.ImageHeight)
+		case "{turn}":
+			return strconv.Itoa(turn)
+		case "{timestamp}":
+			return started.Format(timestampLayout)
+		case "{rule}":
+			return unsafeInName.ReplaceAllString(rule.String(), "-")
+		}
+		return name
+	})
+}
+
+// outputDir is the folder the world is written out to
+func outputDir(p Params) string {
+	if p.OutputDir != "" {
+		return p.OutputDir
+	}
+	return "out"
+}
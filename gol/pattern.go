@@ -0,0 +1,218 @@
+package gol
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"uk.ac.bris.cs/gameoflife/kernel"
+	"uk.ac.bris.cs/gameoflife/util"
+)
+
+// pattern is a pattern read from an rle, cells or Life 1.06 file, which only hold the cells of the pattern itself rather than a whole world.
+// Rule is the rule the file gives, or empty if it doesn't, and Cells holds the state of each cell row by row.
+// rows can be shorter than Width, as the dead cells at the end of a row can be left out.
+// Offset is where the top left cell goes, from the middle of the world, for files that say where their cells are. otherwise it is nil,
+// and the pattern is put in the middle of the world
+type pattern struct {
+	Width  int
+	Height int
+	Rule   string
+	Cells  [][]int
+	Offset *util.Cell
+}
+
+// corner is where the top left cell of the pattern goes in a world of the given size
+func (p pattern) corner(width, height int) (left, top int, err error) {
+	left, top = (width-p.Width)/2, (height-p.Height)/2
+	if p.Offset != nil {
+		left, top = width/2+p.Offset.X, height/2+p.Offset.Y
+	}
+	if left < 0 || top < 0 || left+p.Width > width || top+p.Height > height {
+		return 0, 0, fmt.Errorf("the pattern is %dx%d, which doesn't fit in the %dx%d world asked for", p.Width, p.Height, width, height)
+	}
+	return left, top, nil
+}
+
+// place lays the pattern out in a world of grey levels with the given size, for cells with the given number of states
+func (p pattern) place(width, height, states int) ([][]byte, error) {
+	left, top, err := p.corner(width, height)
+	if err != nil {
+		return nil, err
+	}
+	world := make([][]byte, height)
+	for y := range world {
+		world[y] = make([]byte, width)
+	}
+	for y, row := range p.Cells {
+		for x, state := range row {
+			if state >= states {
+				return nil, fmt.Errorf("the pattern has a cell in state %d, but the rule only has %d states", state, states)
+			}
+			world[top+y][left+x] = util.Grey(state, states)
+		}
+	}
+	return world, nil
+}
+
+// readCells reads a plaintext (cells) file, as used by LifeWiki. each line is a row, with . for a dead cell and O for an alive one,
+// and lines starting with ! are comments
+func readCells(path string) (pattern, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return pattern{}, err
+	}
+	defer file.Close()
+
+	var p pattern
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), " \t\r")
+		if strings.HasPrefix(line, "!") {
+			continue
+		}
+		row := make([]int, len(line))
+		for x, c := range line {
+			switch c {
+			case '.':
+			case 'O', '*':
+				row[x] = 1
+			default:
+				return pattern{}, fmt.Errorf("%v has %q in row %d, which is neither . nor O", path, c, len(p.Cells)+1)
+			}
+		}
+		p.Cells = append(p.Cells, row)
+		if len(row) > p.Width {
+			p.Width = len(row)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return pattern{}, err
+	}
+	p.Height = len(p.Cells)
+	return p, nil
+}
+
+// writeCells writes a world of grey levels as a plaintext (cells) file. only the alive cells of the rule are written as O,
+// and every row is written in full, so the world is the same size when it is read back in
+func writeCells(path string, world [][]byte, rule kernel.Rule) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	writer := bufio.NewWriter(file)
+
+	fmt.Fprintf(writer, "!Rule: %v\n", rule)
+	for _, row := range world {
+		line := make([]byte, len(row))
+		for x, grey := range row {
+			line[x] = '.'
+			if util.StateOf(grey, rule.States) == 1 {
+				line[x] = 'O'
+			}
+		}
+		writer.Write(line)
+		writer.WriteString("\n")
+	}
+
+	if err := writer.Flush(); err != nil {
+		return err
+	}
+	return file.Sync()
+}
+
+// readLife106 reads a Life 1.06 file: a #Life 1.06 line, then the x and y of each alive cell, one cell to a line.
+// the cells are placed with 0 0 in the middle of the world, as Golly does
+func readLife106(path string) (pattern, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return pattern{}, err
+	}
+	defer file.Close()
+
+	var cells []util.Cell
+	scanner := bufio.NewScanner(file)
+	if !scanner.Scan() || strings.TrimSpace(scanner.Text()) != "#Life 1.06" {
+		return pattern{}, fmt.Errorf("%v is not a Life 1.06 file, which starts with #Life 1.06", path)
+	}
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			return pattern{}, fmt.Errorf("%v has %q, which isn't the x and y of a cell", path, line)
+		}
+		x, errX := strconv.Atoi(fields[0])
+		y, errY := strconv.Atoi(fields[1])
+		if errX != nil || errY != nil {
+			return pattern{}, fmt.Errorf("%v has %q, which isn't the x and y of a cell", path, line)
+		}
+		cells = append(cells, util.Cell{X: x, Y: y})
+	}
+	if err := scanner.Err(); err != nil {
+		return pattern{}, err
+	}
+
+	if len(cells) == 0 {
+		return pattern{Offset: &util.Cell{}}, nil
+	}
+	//the pattern is the box around the cells, with its top left at the smallest x and y
+	min, max := cells[0], cells[0]
+	for _, cell := range cells {
+		if cell.X < min.X {
+			min.X = cell.X
+		}
+		if cell.Y < min.Y {
+			min.Y = cell.Y
+		}
+		if cell.X > max.X {
+			max.X = cell.X
+		}
+		if cell.Y > max.Y {
+			max.Y = cell.Y
+		}
+	}
+	p := pattern{Width: max.X - min.X + 1, Height: max.Y - min.Y + 1, Offset: &min}
+	p.Cells = make([][]int, p.Height)
+	for _, cell := range cells {
+		row := &p.Cells[cell.Y-min.Y]
+		for len(*row) <= cell.X-min.X {
+			*row = append(*row, 0)
+		}
+		(*row)[cell.X-min.X] = 1
+	}
+	return p, nil
+}
+
+// writeLife106 writes the alive cells of a world of grey levels as a Life 1.06 file, with 0 0 in the middle of the world
+func writeLife106(path string, world [][]byte, rule kernel.Rule) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	writer := bufio.NewWriter(file)
+
+	height, width := len(world), 0
+	if height > 0 {
+		width = len(world[0])
+	}
+	fmt.Fprintln(writer, "#Life 1.06")
+	for y, row := range world {
+		for x, grey := range row {
+			if util.StateOf(grey, rule.States) == 1 {
+				fmt.Fprintf(writer, "%d %d\n", x-width/2, y-height/2)
+			}
+		}
+	}
+
+	if err := writer.Flush(); err != nil {
+		return err
+	}
+	return file.Sync()
+}
@@ -0,0 +1,179 @@
+package gol
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+)
+
+// pgmHeader is what the header of a pgm file says: its size, the largest grey level it has (which is white), and whether it is a plain
+// (P2) file, with the grey levels written out as numbers, rather than a raw (P5) one with them as bytes
+type pgmHeader struct {
+	width  int
+	height int
+	maxval int
+	plain  bool
+}
+
+// pgmReader reads a pgm file a grey level at a time, without holding all of it at once
+type pgmReader struct {
+	path   string
+	reader *bufio.Reader
+	header pgmHeader
+	read   int
+}
+
+// newPgmReader reads the header of a pgm file, which is P5 or P2, then the width, height and maxval,
+// with comments from # to the end of a line allowed in between them
+func newPgmReader(path string, r io.Reader) (*pgmReader, error) {
+	p := &pgmReader{path: path, reader: bufio.NewReader(r)}
+	magic, err := p.token()
+	if err != nil || magic != "P5" && magic != "P2" {
+		return nil, fmt.Errorf("%v is not a pgm file, which starts with P5 or P2", path)
+	}
+	p.header.plain = magic == "P2"
+
+	for _, field := range []struct {
+		name  string
+		value *int
+		max   int
+	}{{"width", &p.header.width, 1 << 30}, {"height", &p.header.height, 1 << 30}, {"maxval", &p.header.maxval, 65535}} {
+		token, err := p.token()
+		if err != nil {
+			return nil, fmt.Errorf("%v ends before its %v", path, field.name)
+		}
+		*field.value, err = strconv.Atoi(token)
+		if err != nil || *field.value < 1 || *field.value > field.max {
+			return nil, fmt.Errorf("%v has a %v of %q, which has to be a number from 1 to %d", path, field.name, token, field.max)
+		}
+	}
+	//token stops at the single whitespace byte after the maxval, so the raster of a P5 file starts straight after it
+	return p, nil
+}
+
+// token reads the next whitespace separated token of the header, skipping comments, and the whitespace byte after it
+func (p *pgmReader) token() (string, error) {
+	var token []byte
+	for {
+		b, err := p.reader.ReadByte()
+		if err != nil {
+			if err == io.EOF && len(token) > 0 {
+				return string(token), nil
+			}
+			return "", err
+		}
+		switch {
+		case b == '#':
+			if _, err := p.reader.ReadString('\n'); err != nil && err != io.EOF {
+				return "", err
+			}
+			if len(token) > 0 {
+				return string(token), nil
+			}
+		case b == ' ' || b == '\t' || b == '\n' || b == '\r' || b == '\v' || b == '\f':
+			if len(token) > 0 {
+				return string(token), nil
+			}
+		default:
+			token = append(token, b)
+		}
+	}
+}
+
+// next reads the next grey level, scaled from 0 to maxval into 0 to 255. raw files with a maxval above 255 have two bytes
+// for each grey level, most significant first
+func (p *pgmReader) next() (byte, error) {
+	if p.read == p.header.width*p.header.height {
+		return 0, io.EOF
+	}
+	var value int
+	if p.header.plain {
+		token, err := p.token()
+		if err != nil {
+			return 0, p.short()
+		}
+		value, err = strconv.Atoi(token)
+		if err != nil {
+			return 0, fmt.Errorf("%v has a grey level of %q, which is not a number", p.path, token)
+		}
+	} else {
+		b, err := p.reader.ReadByte()
+		if err != nil {
+			return 0, p.short()
+		}
+		value = int(b)
+		if p.header.maxval > 255 {
+			low, err := p.reader.ReadByte()
+			if err != nil {
+				return 0, p.short()
+			}
+			value = value<<8 | int(low)
+		}
+	}
+	if value < 0 || value > p.header.maxval {
+		return 0, fmt.Errorf("%v has a grey level of %d, past its maxval of %d", p.path, value, p.header.maxval)
+	}
+	p.read++
+	return byte((value*255 + p.header.maxval/2) / p.header.maxval), nil
+}
+
+// each reads every grey level in turn, passing them on to send
+func (p *pgmReader) each(send func(byte)) error {
+	for {
+		grey, err := p.next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		send(grey)
+	}
+}
+
+// short is the error for a file that ends before all its grey levels have been read
+func (p *pgmReader) short() error {
+	return fmt.Errorf("%v is %dx%d, but ends after %d of its %d cells", p.path, p.header.width, p.header.height, p.read, p.header.width*p.header.height)
+}
+
+// checkPgm reads through a pgm file, to make sure it can be loaded before it is needed, and returns its header
+func checkPgm(path string) (pgmHeader, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return pgmHeader{}, err
+	}
+	defer file.Close()
+	p, err := newPgmReader(path, file)
+	if err != nil {
+		return pgmHeader{}, err
+	}
+	return p.header, p.each(func(byte) {})
+}
+
+// writePgm writes a world of grey levels to a raw (P5) pgm file with a maxval of 255.
+func writePgm(path string, world [][]byte) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	writer := bufio.NewWriter(file)
+
+	height, width := len(world), 0
+	if height > 0 {
+		width = len(world[0])
+	}
+	fmt.Fprintf(writer, "P5\n%d %d\n%d\n", width, height, 255)
+	for _, row := range world {
+		if _, err := writer.Write(row); err != nil {
+			return err
+		}
+	}
+
+	if err := writer.Flush(); err != nil {
+		return err
+	}
+	return file.Sync()
+}
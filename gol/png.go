@@ -0,0 +1,69 @@
+package gol
+
+import (
+	"bufio"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"os"
+)
+
+// readPng reads a png image as a world of grey levels, with a cell for each pixel. colours are turned into grey levels by their brightness,
+// so with only alive and dead cells, a pixel is alive if it is at least half as bright as white. transparent pixels are dead
+func readPng(path string) ([][]byte, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	img, err := png.Decode(bufio.NewReader(file))
+	if err != nil {
+		return nil, fmt.Errorf("%v is not a png image: %v", path, err)
+	}
+
+	bounds := img.Bounds()
+	world := make([][]byte, bounds.Dy())
+	for y := range world {
+		world[y] = make([]byte, bounds.Dx())
+		for x := range world[y] {
+			world[y][x] = color.GrayModel.Convert(img.At(bounds.Min.X+x, bounds.Min.Y+y)).(color.Gray).Y
+		}
+	}
+	return world, nil
+}
+
+// writePng writes a world of grey levels as a grey png image, with each cell scale pixels across
+func writePng(path string, world [][]byte, scale int) error {
+	if scale < 1 {
+		scale = 1
+	}
+	height, width := len(world), 0
+	if height > 0 {
+		width = len(world[0])
+	}
+	img := image.NewGray(image.Rect(0, 0, width*scale, height*scale))
+	for y, row := range world {
+		for x, grey := range row {
+			for dy := 0; dy < scale; dy++ {
+				for dx := 0; dx < scale; dx++ {
+					img.Pix[(y*scale+dy)*img.Stride+x*scale+dx] = grey
+				}
+			}
+		}
+	}
+
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	writer := bufio.NewWriter(file)
+	if err := png.Encode(writer, img); err != nil {
+		return err
+	}
+	if err := writer.Flush(); err != nil {
+		return err
+	}
+	return file.Sync()
+}
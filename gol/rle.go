@@ -0,0 +1,241 @@
+package gol
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"uk.ac.bris.cs/gameoflife/kernel"
+	"uk.ac.bris.cs/gameoflife/util"
+)
+
+// the longest line an RLE file is written with, which is what Golly uses
+const rleLineLength = 70
+
+// readRle reads an RLE file. the header line, x = 3, y = 3, rule = B3/S23, says the size of the pattern and (optionally) its rule,
+// and the lines after it are the cells: b for dead, o for alive, . and A to X (or pA to yO) for the states of patterns with more than two,
+// each with an optional count in front, $ for the end of a row and ! for the end of the p. lines starting with # are comments
+func readRle(path string) (pattern, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return pattern{}, err
+	}
+	defer file.Close()
+
+	var p pattern
+	header := false
+	var body strings.Builder
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if !header {
+			if p, err = parseRleHeader(line); err != nil {
+				return pattern{}, fmt.Errorf("%v: %v", path, err)
+			}
+			header = true
+			continue
+		}
+		body.WriteString(line)
+		if strings.Contains(line, "!") {
+			break
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return pattern{}, err
+	}
+	if !header {
+		return pattern{}, fmt.Errorf("%v is not an rle file, as it has no x = ..., y = ... header", path)
+	}
+
+	p.Cells = [][]int{nil}
+	count := 0
+	cells := body.String()
+	for i := 0; i < len(cells); i++ {
+		c := rune(cells[i])
+		if unicode.IsSpace(c) {
+			continue
+		}
+		if unicode.IsDigit(c) {
+			count = count*10 + int(c-'0')
+			continue
+		}
+		run := count
+		if run == 0 {
+			run = 1
+		}
+		count = 0
+
+		state := 0
+		switch {
+		case c == '!':
+			i = len(cells)
+			continue
+		case c == '$':
+			for ; run > 0; run-- {
+				p.Cells = append(p.Cells, nil)
+			}
+			continue
+		case c == 'b' || c == '.':
+			state = 0
+		case c == 'o':
+			state = 1
+		case c >= 'A' && c <= 'X':
+			state = int(c-'A') + 1
+		case c >= 'p' && c <= 'y' && i+1 < len(cells) && cells[i+1] >= 'A' && cells[i+1] <= 'X':
+			//states past X are written as a letter from p saying which block of 24 they are in, then the one in that block
+			i++
+			state = 24*int(c-'p'+1) + int(cells[i]-'A') + 1
+		default:
+			return pattern{}, fmt.Errorf("%v has %q in its cells, which isn't a state", path, c)
+		}
+		row := &p.Cells[len(p.Cells)-1]
+		for ; run > 0; run-- {
+			*row = append(*row, state)
+		}
+	}
+
+	//the rows can't reach past the size the header gives, so the pattern can be placed by its header alone
+	if len(p.Cells) > p.Height {
+		return pattern{}, fmt.Errorf("%v has %d rows, but its header says y = %d", path, len(p.Cells), p.Height)
+	}
+	for _, row := range p.Cells {
+		if len(row) > p.Width {
+			return pattern{}, fmt.Errorf("%v has a row of %d cells, but its header says x = %d", path, len(row), p.Width)
+		}
+	}
+	return p, nil
+}
+
+// parseRleHeader reads a header line such as x = 3, y = 3, rule = B3/S23
+func parseRleHeader(line string) (pattern, error) {
+	var p pattern
+	seen := make(map[string]bool)
+	//the rule comes last, and can have commas of its own (in Larger than Life notation), so it is everything after rule =
+	sizes := line
+	if r := strings.Index(line, "rule"); r >= 0 {
+		sizes = strings.TrimSuffix(strings.TrimSpace(line[:r]), ",")
+		rule := strings.SplitN(line[r:], "=", 2)
+		if len(rule) != 2 {
+			return pattern{}, fmt.Errorf("%q is not an rle header, e.g. x = 3, y = 3, rule = B3/S23", line)
+		}
+		p.Rule = rleRule(strings.TrimSpace(rule[1]))
+	}
+	for _, part := range strings.Split(sizes, ",") {
+		keyValue := strings.SplitN(part, "=", 2)
+		if len(keyValue) != 2 {
+			return pattern{}, fmt.Errorf("%q is not an rle header, e.g. x = 3, y = 3, rule = B3/S23", line)
+		}
+		key, value := strings.TrimSpace(keyValue[0]), strings.TrimSpace(keyValue[1])
+		seen[key] = true
+		var err error
+		switch key {
+		case "x":
+			p.Width, err = strconv.Atoi(value)
+		case "y":
+			p.Height, err = strconv.Atoi(value)
+		}
+		if err != nil || p.Width < 0 || p.Height < 0 {
+			return pattern{}, fmt.Errorf("the rle header %q has a size that isn't a number of cells", line)
+		}
+	}
+	if !seen["x"] || !seen["y"] {
+		return pattern{}, fmt.Errorf("the rle header %q needs both x and y", line)
+	}
+	return p, nil
+}
+
+// rleRule turns the rule of an rle header into the notation ParseRule reads. Golly adds the size of a bounded grid to the end,
+// e.g. B3/S23:T64,64, which is dropped, and older files give the survivals first without letters, e.g. 23/3 for B3/S23
+func rleRule(rule string) string {
+	rule = strings.SplitN(rule, ":", 2)[0]
+	parts := strings.Split(rule, "/")
+	if len(parts) == 2 && strings.Trim(rule, "0123456789/") == "" {
+		return "B" + parts[1] + "/S" + parts[0]
+	}
+	return rule
+}
+
+// writeRle writes a world of grey levels as an RLE file, reading each grey level as one of the rule's states
+func writeRle(path string, world [][]byte, rule kernel.Rule) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	writer := bufio.NewWriter(file)
+
+	height, width := len(world), 0
+	if height > 0 {
+		width = len(world[0])
+	}
+	fmt.Fprintf(writer, "x = %d, y = %d, rule = %v\n", width, height, rule)
+
+	//the runs are written one after the other, starting a new line rather than going past rleLineLength
+	line := 0
+	write := func(count int, tag string) {
+		run := tag
+		if count > 1 {
+			run = strconv.Itoa(count) + tag
+		}
+		if line+len(run) > rleLineLength {
+			writer.WriteString("\n")
+			line = 0
+		}
+		writer.WriteString(run)
+		line += len(run)
+	}
+
+	//the dead cells at the end of a row, and the empty rows at the end, are left out. empty rows in between are added to the count of $
+	endOfRows := 0
+	for _, row := range world {
+		end := len(row)
+		for end > 0 && util.StateOf(row[end-1], rule.States) == 0 {
+			end--
+		}
+		if end == 0 {
+			endOfRows++
+			continue
+		}
+		if endOfRows > 0 {
+			write(endOfRows, "$")
+		}
+		for x := 0; x < end; {
+			state := util.StateOf(row[x], rule.States)
+			run := 1
+			for x+run < end && util.StateOf(row[x+run], rule.States) == state {
+				run++
+			}
+			write(run, rleState(state, rule.States))
+			x += run
+		}
+		endOfRows = 1
+	}
+	write(1, "!")
+	writer.WriteString("\n")
+
+	if err := writer.Flush(); err != nil {
+		return err
+	}
+	return file.Sync()
+}
+
+// rleState is the tag a state is written as: b and o with two states, and . and A to X (then pA to yO) with more
+func rleState(state, states int) string {
+	switch {
+	case states <= 2 && state == 0:
+		return "b"
+	case states <= 2:
+		return "o"
+	case state == 0:
+		return "."
+	case state <= 24:
+		return string(rune('A' + state - 1))
+	}
+	return string(rune('p'+(state-1)/24-1)) + string(rune('A'+(state-1)%24))
+}
@@ -1,10 +1,15 @@
 package main
 
 import (
+	"bytes"
 	"fmt"
+	"os"
+	"path/filepath"
 	"testing"
 
 	"uk.ac.bris.cs/gameoflife/gol"
+	"uk.ac.bris.cs/gameoflife/hashlife"
+	"uk.ac.bris.cs/gameoflife/kernel"
 	"uk.ac.bris.cs/gameoflife/util"
 )
 
@@ -42,3 +47,153 @@ func TestGol(t *testing.T) {
 		}
 	}
 }
+
+// runToEnd runs the Game of Life through to the end, with the output written out, and returns the FinalTurnComplete event it finished with.
+// anything that goes wrong on the way fails the test
+func runToEnd(t *testing.T, p gol.Params) gol.FinalTurnComplete {
+	t.Helper()
+	events := make(chan gol.Event)
+	go gol.Run(p, events, nil)
+	var final gol.FinalTurnComplete
+	finished := false
+	for event := range events {
+		switch e := event.(type) {
+		case gol.FinalTurnComplete:
+			final, finished = e, true
+		case gol.RunError:
+			t.Error(e)
+		}
+	}
+	if !finished {
+		t.Fatal("the run ended without a FinalTurnComplete event")
+	}
+	return final
+}
+
+// advanceKernels runs each kernel on its own on the whole world for a number of turns, and returns the world each of them ends on
+func advanceKernels(world util.BitBoard, rule kernel.Rule, boundary util.Boundary, turns int) []util.BitBoard {
+	var worlds []util.BitBoard
+	for _, updateCells := range []func(util.BitBoard, int, int, kernel.Rule, util.Boundary, chan [][]uint64){kernel.UpdateCells, kernel.UpdateCellsBitSliced} {
+		advanced := world
+		rowsChan := make(chan [][]uint64, 1)
+		for turn := 0; turn < turns; turn++ {
+			updateCells(advanced, 0, advanced.Height, rule, boundary, rowsChan)
+			advanced = advanced.WithRows(<-rowsChan)
+		}
+		worlds = append(worlds, advanced)
+	}
+	return worlds
+}
+
+// ruleTest is a rule checkRules runs, with the neighbourhood and boundary it is run with, and its check images in the check folder as <size>x<size>x<turns>.pgm.
+// start is the image each world starts from, with its size filled in twice, and leaving it empty uses images/<size>x<size>.pgm
+type ruleTest struct {
+	name          string
+	check         string
+	rule          string
+	neighbourhood string
+	boundary      string
+	start         string
+}
+
+// checkRules tests 16x16 and 64x64 images on 1 and 100 turns of each rule against its check images, cell state by cell state, through each kernel
+// on its own, through HashLife on its own when it supports the rule, and through the broker and servers on the stitch and p2p engines.
+// the engines are run with more than one turn per batch, so the halos are checked too, and the PGM image written out is checked as well as the alive cells
+func checkRules(t *testing.T, tests []ruleTest) {
+	for _, test := range tests {
+		rule, err := kernel.ParseRule(test.rule)
+		util.Check(err)
+		if test.neighbourhood != "" {
+			neighbourhood, err := kernel.ParseNeighbourhood(test.neighbourhood)
+			util.Check(err)
+			rule, err = rule.WithNeighbourhood(neighbourhood)
+			util.Check(err)
+		}
+		boundary, err := util.ParseBoundary(test.boundary)
+		util.Check(err)
+		for _, size := range []int{16, 64} {
+			input := fmt.Sprintf("images/%vx%v.pgm", size, size)
+			if test.start != "" {
+				input = fmt.Sprintf(test.start, size, size)
+			}
+			start := util.PackStates(readGreys(input, size, size), rule.States)
+			for _, turns := range []int{1, 100} {
+				p := gol.Params{ImageWidth: size, ImageHeight: size, Turns: turns, Threads: 1, TurnsPerBatch: 7, Rule: test.rule,
+					Neighbourhood: test.neighbourhood, Boundary: test.boundary, InputPath: input}
+				expected := readGreys(fmt.Sprintf("%v/%vx%vx%v.pgm", test.check, size, size, turns), size, size)
+				expectedAlive := util.PackStates(expected, rule.States).AliveCells()
+
+				t.Run(fmt.Sprintf("%v/%dx%dx%d", test.name, size, size, turns), func(t *testing.T) {
+					for _, world := range advanceKernels(start, rule, boundary, turns) {
+						assertEqualGreys(t, world.Unpack(), expected)
+					}
+					if hashlife.Supported(size, size, rule, boundary) {
+						life := hashlife.New(start, rule)
+						life.Advance(turns)
+						assertEqualGreys(t, life.Board().Unpack(), expected)
+					}
+
+					for _, engine := range []string{"stitch", "p2p"} {
+						p.Engine = engine
+						emptyOutFolder()
+						assertEqualBoard(t, runToEnd(t, p).Alive, expectedAlive, p)
+						assertEqualGreys(t, readGreys(fmt.Sprintf("out/%vx%vx%v.pgm", size, size, turns), size, size), expected)
+					}
+				})
+			}
+		}
+	}
+}
+
+// checkOutput runs the Game of Life through to the end with an empty out folder, and checks the PGM image written out at the end is the expected one
+func checkOutput(t *testing.T, p gol.Params, expected string) {
+	t.Helper()
+	p, err := gol.WithInput(p)
+	util.Check(err)
+	emptyOutFolder()
+	runToEnd(t, p)
+	written := fmt.Sprintf("out/%vx%vx%v.pgm", p.ImageWidth, p.ImageHeight, p.Turns)
+	assertEqualGreys(t, readGreys(written, p.ImageWidth, p.ImageHeight), readGreys(expected, p.ImageWidth, p.ImageHeight))
+}
+
+// writeOut runs the Game of Life through to the end with an empty out folder, and returns a copy, outside the out folder,
+// of the world written out at the end in the format
+func writeOut(t *testing.T, p gol.Params, format string) string {
+	t.Helper()
+	p, err := gol.WithInput(p)
+	util.Check(err)
+	emptyOutFolder()
+	runToEnd(t, p)
+	name := fmt.Sprintf("%vx%vx%v.%v", p.ImageWidth, p.ImageHeight, p.Turns, format)
+	data, err := os.ReadFile(filepath.Join("out", name))
+	util.Check(err)
+	written := filepath.Join(t.TempDir(), name)
+	util.Check(os.WriteFile(written, data, 0644))
+	return written
+}
+
+// readGreys loads the grey level of every cell of a PGM image, which readWorld would turn into 0 or 255
+func readGreys(path string, width, height int) [][]byte {
+	data, err := os.ReadFile(path)
+	util.Check(err)
+	pixels := data[len(data)-width*height:]
+	world := make([][]byte, height)
+	for y := range world {
+		world[y] = pixels[y*width : (y+1)*width]
+	}
+	return world
+}
+
+// assertEqualGreys fails the test at the first cell whose grey level isn't the expected one
+func assertEqualGreys(t *testing.T, given, expected [][]byte) {
+	for y := range expected {
+		if !bytes.Equal(given[y], expected[y]) {
+			for x := range expected[y] {
+				if given[y][x] != expected[y][x] {
+					t.Errorf("cell (%v, %v) is grey level %v, expected %v", x, y, given[y][x], expected[y][x])
+					return
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,268 @@
+// Package hashlife advances a world with HashLife. the world is held as a quadtree where identical squares share a node,
+// and the result of advancing each square is remembered, so patterns that repeat in space or time are only ever worked out once.
+//
+// the world wraps around at its edges, which is the same as an infinite plane tiled with copies of it.
+// that tiling is itself a quadtree built from the world's node, so jumping 2^j turns ahead is a single lookup for a square big enough to cover them
+package hashlife
+
+import (
+	"uk.ac.bris.cs/gameoflife/kernel"
+	"uk.ac.bris.cs/gameoflife/util"
+)
+
+// maxNodes is how many squares are remembered before the memory is cleared out and the world is rebuilt from scratch
+const maxNodes = 1 << 21
+
+// node is a square of 2^level by 2^level cells. level 0 nodes are single cells and have no quadrants
+type node struct {
+	nw, ne, sw, se *node
+	level          int
+	population     int
+}
+
+type quadrants struct {
+	nw, ne, sw, se *node
+}
+
+type stepKey struct {
+	n *node
+	j int
+}
+
+// Life is a world being advanced with HashLife
+type Life struct {
+	width int
+	level int
+	root  *node
+	rule  kernel.Rule
+
+	dead, alive *node
+	nodes       map[quadrants]*node
+	steps       map[stepKey]*node
+	empty       []*node
+	tiles       []*node
+}
+
+// Supported reports whether a world can be advanced with HashLife under a rule and boundary. it needs to be a square with a power of two side
+// that wraps around as a torus, and the cells can only be alive or dead, under a rule that counts the 8 cells around (and no others)
+func Supported(width, height int, rule kernel.Rule, boundary util.Boundary) bool {
+	return width == height && width >= 2 && width&(width-1) == 0 && rule.Table == nil && rule.States <= 2 && rule.Radius <= 1 && rule.Neighbourhood == kernel.Moore && boundary == util.Torus
+}
+
+// New starts a HashLife run from the given world, which must be Supported, under the rule
+func New(board util.BitBoard, rule kernel.Rule) *Life {
+	l := &Life{width: board.Width, rule: rule}
+	for 1<<uint(l.level) < l.width {
+		l.level++
+	}
+	l.reset(board)
+	return l
+}
+
+// reset clears out every remembered square and rebuilds the world from a board
+func (l *Life) reset(board util.BitBoard) {
+	l.dead = &node{}
+	l.alive = &node{population: 1}
+	l.nodes = make(map[quadrants]*node)
+	l.steps = make(map[stepKey]*node)
+	l.empty = []*node{l.dead}
+	l.tiles = nil
+	l.root = l.fromBoard(board, 0, 0, l.level)
+}
+
+// join finds the node with the given quadrants, making it if it doesn't exist yet
+func (l *Life) join(nw, ne, sw, se *node) *node {
+	q := quadrants{nw, ne, sw, se}
+	if n, ok := l.nodes[q]; ok {
+		return n
+	}
+	n := &node{nw: nw, ne: ne, sw: sw, se: se, level: nw.level + 1, population: nw.population + ne.population + sw.population + se.population}
+	l.nodes[q] = n
+	return n
+}
+
+// emptyNode is the all dead square at a level
+func (l *Life) emptyNode(level int) *node {
+	for len(l.empty) <= level {
+		e := l.empty[len(l.empty)-1]
+		l.empty = append(l.empty, l.join(e, e, e, e))
+	}
+	return l.empty[level]
+}
+
+// tile is the square at a level of the plane tiled with the world, lined up so the world is in its top left corner
+func (l *Life) tile(level int) *node {
+	if level == l.level {
+		return l.root
+	}
+	if l.tiles == nil {
+		l.tiles = []*node{l.root}
+	}
+	for len(l.tiles) <= level-l.level {
+		t := l.tiles[len(l.tiles)-1]
+		l.tiles = append(l.tiles, l.join(t, t, t, t))
+	}
+	return l.tiles[level-l.level]
+}
+
+// fromBoard builds the node for the square of the board at (x, y)
+func (l *Life) fromBoard(board util.BitBoard, x, y, level int) *node {
+	if level == 0 {
+		if board.Alive(x, y) {
+			return l.alive
+		}
+		return l.dead
+	}
+	half := 1 << uint(level-1)
+	return l.join(
+		l.fromBoard(board, x, y, level-1),
+		l.fromBoard(board, x+half, y, level-1),
+		l.fromBoard(board, x, y+half, level-1),
+		l.fromBoard(board, x+half, y+half, level-1),
+	)
+}
+
+// Board returns the world as it is now
+func (l *Life) Board() util.BitBoard {
+	board := util.NewBitBoard(l.width, l.width)
+	l.toBoard(board, l.root, 0, 0)
+	return board
+}
+
+func (l *Life) toBoard(board util.BitBoard, n *node, x, y int) {
+	if n.population == 0 {
+		return
+	}
+	if n.level == 0 {
+		board.Set(x, y, true)
+		return
+	}
+	half := 1 << uint(n.level-1)
+	l.toBoard(board, n.nw, x, y)
+	l.toBoard(board, n.ne, x+half, y)
+	l.toBoard(board, n.sw, x, y+half)
+	l.toBoard(board, n.se, x+half, y+half)
+}
+
+// Count returns the number of alive cells in the world
+func (l *Life) Count() int {
+	return l.root.population
+}
+
+// Advance moves the world on by a number of turns, a power of two at a time
+func (l *Life) Advance(turns int) {
+	for j := 0; turns>>uint(j) != 0; j++ {
+		if turns>>uint(j)&1 == 1 {
+			l.advancePowerOfTwo(j)
+		}
+	}
+}
+
+// advancePowerOfTwo moves the world on by 2^j turns
+func (l *Life) advancePowerOfTwo(j int) {
+	//the result of a square is its centre, half as wide, 2^(level-2) turns later. the tiling is used so the square is big enough
+	level := j + 2
+	if level < l.level+1 {
+		level = l.level + 1
+	}
+	result := l.successor(l.tile(level), j)
+
+	//the centre starts 2^(level-2) cells in, which is a whole number of worlds along unless the square is only twice the world's size
+	for result.level > l.level {
+		result = result.nw
+	}
+	if level == l.level+1 {
+		//in which case the centre is out by half a world each way, so the quadrants are swapped back round
+		result = l.join(result.se, result.sw, result.ne, result.nw)
+	}
+	l.root = result
+	l.tiles = nil
+
+	if len(l.nodes) > maxNodes {
+		l.reset(l.Board())
+	}
+}
+
+// successor is the centre of a square, half as wide, 2^j turns later. j can't be more than the square's level-2
+func (l *Life) successor(n *node, j int) *node {
+	//nothing comes of nothing, unless the rule brings cells to life with no neighbours
+	if n.population == 0 && l.rule.Birth&1 == 0 {
+		return l.emptyNode(n.level - 1)
+	}
+	if j > n.level-2 {
+		j = n.level - 2
+	}
+	key := stepKey{n, j}
+	if result, ok := l.steps[key]; ok {
+		return result
+	}
+
+	var result *node
+	if n.level == 2 {
+		result = l.life4x4(n)
+	} else {
+		//the nine overlapping squares, half as wide, that cover the centre of n
+		c1 := l.successor(l.join(n.nw.nw, n.nw.ne, n.nw.sw, n.nw.se), j)
+		c2 := l.successor(l.join(n.nw.ne, n.ne.nw, n.nw.se, n.ne.sw), j)
+		c3 := l.successor(l.join(n.ne.nw, n.ne.ne, n.ne.sw, n.ne.se), j)
+		c4 := l.successor(l.join(n.nw.sw, n.nw.se, n.sw.nw, n.sw.ne), j)
+		c5 := l.successor(l.join(n.nw.se, n.ne.sw, n.sw.ne, n.se.nw), j)
+		c6 := l.successor(l.join(n.ne.sw, n.ne.se, n.se.nw, n.se.ne), j)
+		c7 := l.successor(l.join(n.sw.nw, n.sw.ne, n.sw.sw, n.sw.se), j)
+		c8 := l.successor(l.join(n.sw.ne, n.se.nw, n.sw.se, n.se.sw), j)
+		c9 := l.successor(l.join(n.se.nw, n.se.ne, n.se.sw, n.se.se), j)
+
+		if j < n.level-2 {
+			//they are already 2^j turns on, so their centres are put together without going any further
+			result = l.join(
+				l.join(c1.se, c2.sw, c4.ne, c5.nw),
+				l.join(c2.se, c3.sw, c5.ne, c6.nw),
+				l.join(c4.se, c5.sw, c7.ne, c8.nw),
+				l.join(c5.se, c6.sw, c8.ne, c9.nw),
+			)
+		} else {
+			//they are half way there, so the four squares they make up are advanced the other half
+			result = l.join(
+				l.successor(l.join(c1, c2, c4, c5), j),
+				l.successor(l.join(c2, c3, c5, c6), j),
+				l.successor(l.join(c4, c5, c7, c8), j),
+				l.successor(l.join(c5, c6, c8, c9), j),
+			)
+		}
+	}
+
+	l.steps[key] = result
+	return result
+}
+
+// life4x4 works out the next state of the centre 2x2 cells of a 4x4 square, one cell at a time
+func (l *Life) life4x4(n *node) *node {
+	var cells [4][4]int
+	for y, row := range [2][2]*node{{n.nw, n.ne}, {n.sw, n.se}} {
+		for x, q := range row {
+			cells[y*2][x*2] = q.nw.population
+			cells[y*2][x*2+1] = q.ne.population
+			cells[y*2+1][x*2] = q.sw.population
+			cells[y*2+1][x*2+1] = q.se.population
+		}
+	}
+
+	var next [2][2]*node
+	for y := 1; y <= 2; y++ {
+		for x := 1; x <= 2; x++ {
+			liveNeighbours := 0
+			for dy := -1; dy <= 1; dy++ {
+				for dx := -1; dx <= 1; dx++ {
+					if dx != 0 || dy != 0 {
+						liveNeighbours += cells[y+dy][x+dx]
+					}
+				}
+			}
+			next[y-1][x-1] = l.dead
+			if l.rule.Next(cells[y][x] == 1, liveNeighbours) {
+				next[y-1][x-1] = l.alive
+			}
+		}
+	}
+	return l.join(next[0][0], next[0][1], next[1][0], next[1][1])
+}
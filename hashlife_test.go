@@ -0,0 +1,77 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"hash/fnv"
+	"testing"
+
+	"uk.ac.bris.cs/gameoflife/gol"
+	"uk.ac.bris.cs/gameoflife/hashlife"
+	"uk.ac.bris.cs/gameoflife/kernel"
+	"uk.ac.bris.cs/gameoflife/util"
+)
+
+// TestHashLife tests the hashlife engine on 16x16, 64x64 and 512x512 at 100 turns against the check images,
+// and at large turn counts against the answer worked out by running the kernel until the world repeats itself
+func TestHashLife(t *testing.T) {
+	for _, size := range []int{16, 64, 512} {
+		start := util.PackWorld(readWorld(fmt.Sprintf("images/%vx%v.pgm", size, size), size, size))
+		expected := map[int][]util.Cell{
+			100: readAliveCells(fmt.Sprintf("check/images/%vx%vx100.pgm", size, size), size, size),
+		}
+		for _, turns := range []int{12345, 10000000000} {
+			expected[turns] = aliveAfter(start, turns)
+		}
+
+		for _, turns := range []int{100, 12345, 10000000000} {
+			p := gol.Params{ImageWidth: size, ImageHeight: size, Turns: turns, Threads: 1, Engine: "hashlife"}
+			t.Run(fmt.Sprintf("%dx%dx%d", size, size, turns), func(t *testing.T) {
+				life := hashlife.New(start, kernel.Conway)
+				life.Advance(turns)
+				assertEqualBoard(t, life.Board().AliveCells(), expected[turns], p)
+
+				assertEqualBoard(t, runToEnd(t, p).Alive, expected[turns], p)
+			})
+		}
+	}
+}
+
+// aliveAfter runs the kernel on the world until it comes back to a state it has been in before.
+// from then on it just goes round the same cycle, so the state at any turn is the same as one in the first time round
+func aliveAfter(world util.BitBoard, turns int) []util.Cell {
+	seen := make(map[uint64]int)
+	state := world
+	for turn := 0; turn < turns; turn++ {
+		if first, ok := seen[hashBoard(state)]; ok {
+			period := turn - first
+			return advanceKernel(world, first+(turns-first)%period).AliveCells()
+		}
+		seen[hashBoard(state)] = turn
+		state = advanceKernel(state, 1)
+	}
+	return state.AliveCells()
+}
+
+// advanceKernel runs the bit-sliced kernel on the whole world for a number of turns
+func advanceKernel(world util.BitBoard, turns int) util.BitBoard {
+	rowsChan := make(chan [][]uint64, 1)
+	for turn := 0; turn < turns; turn++ {
+		kernel.UpdateCellsBitSliced(world, 0, world.Height, kernel.Conway, util.Torus, rowsChan)
+		world = world.WithRows(<-rowsChan)
+	}
+	return world
+}
+
+// hashBoard is a 64-bit FNV-1a hash of the board's words
+func hashBoard(board util.BitBoard) uint64 {
+	hash := fnv.New64a()
+	word := make([]byte, 8)
+	for _, row := range board.Rows {
+		for _, w := range row {
+			binary.LittleEndian.PutUint64(word, w)
+			hash.Write(word)
+		}
+	}
+	return hash.Sum64()
+}
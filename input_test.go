@@ -0,0 +1,60 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"uk.ac.bris.cs/gameoflife/gol"
+	"uk.ac.bris.cs/gameoflife/util"
+)
+
+// TestInput tests worlds loaded from an InputPath, without being told their size: a Wireworld check image, which should end on the one
+// 100 turns on, and a world that isn't square, cut out of the 64x64 image, which is checked against the kernel
+func TestInput(t *testing.T) {
+	t.Run("wireworld/64x64x100", func(t *testing.T) {
+		checkOutput(t, gol.Params{Turns: 100, Threads: 1, Rule: "Wireworld", InputPath: "check/rules/wireworld/64x64x0.pgm"}, "check/rules/wireworld/64x64x100.pgm")
+	})
+
+	width, height := 48, 20
+	world := readWorld("images/64x64.pgm", 64, 64)[10 : 10+height]
+	path := filepath.Join(t.TempDir(), "cut.pgm")
+	file, err := os.Create(path)
+	util.Check(err)
+	fmt.Fprintf(file, "P5\n%d %d\n255\n", width, height)
+	for _, row := range world {
+		_, err = file.Write(row[:width])
+		util.Check(err)
+	}
+	util.Check(file.Close())
+
+	board := advanceKernel(util.PackWorld(readWorld(path, width, height)), 100)
+	p := gol.Params{ImageWidth: 512, ImageHeight: 512, Turns: 100, Threads: 1, InputPath: path}
+	t.Run(fmt.Sprintf("%dx%dx100", width, height), func(t *testing.T) {
+		assertEqualBoard(t, runToEnd(t, p).Alive, board.AliveCells(), gol.Params{ImageWidth: width, ImageHeight: height, Turns: 100})
+	})
+}
+
+// TestWithInput checks the size of a world is read from its InputPath, and that images that can't be loaded give an error rather than a panic
+func TestWithInput(t *testing.T) {
+	p, err := gol.WithInput(gol.Params{ImageWidth: 512, ImageHeight: 512, InputPath: "images/16x16.pgm"})
+	if err != nil || p.ImageWidth != 16 || p.ImageHeight != 16 {
+		t.Errorf("WithInput read images/16x16.pgm as %dx%d, %v", p.ImageWidth, p.ImageHeight, err)
+	}
+
+	notPgm := filepath.Join(t.TempDir(), "not.pgm")
+	util.Check(os.WriteFile(notPgm, []byte("P6\n2 2\n255\n0 0 0 0 0 0 0 0 0 0 0 0\n"), 0644))
+	short := filepath.Join(t.TempDir(), "short.pgm")
+	util.Check(os.WriteFile(short, []byte("P5\n4 4\n255\nabc"), 0644))
+	for _, p := range []gol.Params{
+		{ImageWidth: 20, ImageHeight: 20},
+		{InputPath: "images/missing.pgm"},
+		{InputPath: notPgm},
+		{InputPath: short},
+	} {
+		if _, err := gol.WithInput(p); err == nil {
+			t.Errorf("WithInput(%+v) should have failed", p)
+		}
+	}
+}
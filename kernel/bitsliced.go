@@ -0,0 +1,203 @@
+package kernel
+
+import "uk.ac.bris.cs/gameoflife/util"
+
+// UpdateCellsBitSliced does the same job as UpdateCells, but works on 64 cells at once. each of a cell's eight neighbours is
+// lined up with it by shifting whole rows, then the neighbours are added up bit by bit with full adders, so no cell is looked at on its own
+func UpdateCellsBitSliced(world util.BitBoard, startIndex, endIndex int, rule Rule, boundary util.Boundary, rowsChan chan [][]uint64) {
+	//rule tables look at the state of each neighbour rather than counting them
+	if rule.Table != nil {
+		updateCellsTable(world, startIndex, endIndex, rule, boundary, rowsChan)
+		return
+	}
+	//the adders only cover the 8 cells around, so Larger than Life rules are counted with a summed-area table instead
+	if rule.Radius > 1 {
+		updateCellsLargerThanLife(world, startIndex, endIndex, rule, boundary, rowsChan)
+		return
+	}
+	ImageWidth := world.Width
+	words := util.WordsPerRow(ImageWidth)
+	planes := util.Planes(world.States)
+
+	//the neighbour counts that make a cell alive next turn, and whether they do so for dead cells, alive cells or both
+	var counts []int
+	var births, survivals []bool
+	for n := 0; n <= 8; n++ {
+		born, survives := rule.Next(false, n), rule.Next(true, n)
+		if born || survives {
+			counts = append(counts, n)
+			births = append(births, born)
+			survivals = append(survivals, survives)
+		}
+	}
+
+	//for the rows above, on and below the one being updated: the row itself, and the row with every cell's west and east neighbour in its place
+	var west, centre, east [3][]uint64
+	for k := range west {
+		west[k] = make([]uint64, words)
+		east[k] = make([]uint64, words)
+	}
+	//rows past a dead edge are outside the world, and are treated as a row of dead cells
+	deadRow := make([]uint64, words*planes)
+	load := func(k, i int) {
+		centre[k] = world.RowAt(i, boundary)
+		if len(centre[k]) == 0 {
+			centre[k] = deadRow
+		}
+		//only the first plane, of alive cells, counts towards the neighbours
+		shiftWest(centre[k][:words], ImageWidth, boundary, west[k])
+		shiftEast(centre[k][:words], ImageWidth, boundary, east[k])
+	}
+	//moves the window down a row, reusing the buffers of the row that falls out of it
+	slide := func() {
+		west[0], west[1], west[2] = west[1], west[2], west[0]
+		east[0], east[1], east[2] = east[1], east[2], east[0]
+		centre[0], centre[1] = centre[1], centre[2]
+	}
+	load(0, startIndex-1)
+	load(1, startIndex)
+
+	workerRows := make([][]uint64, endIndex-startIndex)
+	for i := startIndex; i < endIndex; i++ {
+		load(2, i+1)
+		//rows past a dead edge in a halo stay outside the world
+		if len(world.Rows[i]) == 0 {
+			slide()
+			continue
+		}
+
+		newRow := make([]uint64, words*planes)
+		offsets := rule.Neighbourhood.offsets(world.FirstRow + i)
+		//each neighbour lined up with the cells, by the offset it is at
+		lined := [3][3][]uint64{{west[0], centre[0], east[0]}, {west[1], centre[1], east[1]}, {west[2], centre[2], east[2]}}
+		for w := 0; w < words; w++ {
+			//ones, twos, fours and eights are the bits of the number of alive neighbours
+			var ones, twos, fours, eights uint64
+			if rule.Neighbourhood == Moore {
+				aboveSum, aboveCarry := fullAdder(west[0][w], centre[0][w], east[0][w])
+				belowSum, belowCarry := fullAdder(west[2][w], centre[2][w], east[2][w])
+				sideSum, sideCarry := west[1][w]^east[1][w], west[1][w]&east[1][w]
+
+				var onesCarry, twosSum, twosCarry uint64
+				ones, onesCarry = fullAdder(aboveSum, belowSum, sideSum)
+				twosSum, twosCarry = fullAdder(aboveCarry, belowCarry, sideCarry)
+				twos = twosSum ^ onesCarry
+				foursCarry := twosSum & onesCarry
+				fours = twosCarry ^ foursCarry
+				eights = twosCarry & foursCarry
+			} else {
+				//smaller neighbourhoods are added up one neighbour at a time, carrying up through the bits of the count
+				for _, o := range offsets {
+					carry := lined[o.dy+1][o.dx+1][w]
+					ones, carry = ones^carry, ones&carry
+					twos, carry = twos^carry, twos&carry
+					fours, carry = fours^carry, fours&carry
+					eights |= carry
+				}
+			}
+
+			//only dead cells can be born, so for Generations rules the dying cells in the other planes are left out
+			alive := centre[1][w]
+			var dying uint64
+			for p := 1; p < planes; p++ {
+				dying |= centre[1][p*words+w]
+			}
+			dead := ^(alive | dying)
+
+			var next uint64
+			for k, n := range counts {
+				//the cells with exactly n alive neighbours
+				matches := bitIs(ones, n&1) & bitIs(twos, n&2) & bitIs(fours, n&4) & bitIs(eights, n&8)
+				if births[k] {
+					next |= matches & dead
+				}
+				if survivals[k] {
+					next |= matches & alive
+				}
+			}
+			newRow[w] = next
+
+			if planes > 1 {
+				//dying cells move on a state, adding one to the binary number across the planes
+				carry := dying
+				for p := 1; p < planes; p++ {
+					newRow[p*words+w] = centre[1][p*words+w] ^ carry
+					carry &= centre[1][p*words+w]
+				}
+				//cells that have run out of states are dead. if that overflows the planes, they are already 0
+				expired := ^uint64(0)
+				for p := 1; p < planes; p++ {
+					expired &= bitIs(newRow[p*words+w], (world.States-1)>>uint(p-1)&1)
+				}
+				for p := 1; p < planes; p++ {
+					newRow[p*words+w] &^= expired
+				}
+				//and alive cells that don't survive start dying, at state 2
+				newRow[words+w] |= alive &^ next
+			}
+		}
+		//rules that bring cells to life with no neighbours would otherwise fill the bits past the edge of the world
+		for p := 0; p < planes; p++ {
+			newRow[p*words+words-1] &= lastWordMask(ImageWidth)
+		}
+		workerRows[i-startIndex] = newRow
+		slide()
+	}
+	rowsChan <- workerRows
+	return
+}
+
+// bitIs is bits where a bit of the neighbour count should be set, and its complement where it shouldn't
+func bitIs(bits uint64, set int) uint64 {
+	if set != 0 {
+		return bits
+	}
+	return ^bits
+}
+
+// fullAdder adds three bits in each of 64 positions at once
+func fullAdder(a, b, c uint64) (sum, carry uint64) {
+	sum = a ^ b ^ c
+	carry = (a & b) | (c & (a ^ b))
+	return
+}
+
+// shiftWest fills out with the row moved one cell east, so each cell lines up with its west neighbour.
+// the west neighbour of the first cell depends on the boundary
+func shiftWest(row []uint64, ImageWidth int, boundary util.Boundary, out []uint64) {
+	last := len(row) - 1
+	for w := last; w > 0; w-- {
+		out[w] = row[w]<<1 | row[w-1]>>63
+	}
+	out[0] = row[0]<<1 | edgeNeighbour(row, ImageWidth, boundary, -1)
+	out[last] &= lastWordMask(ImageWidth)
+}
+
+// shiftEast fills out with the row moved one cell west, so each cell lines up with its east neighbour.
+// the east neighbour of the last cell depends on the boundary
+func shiftEast(row []uint64, ImageWidth int, boundary util.Boundary, out []uint64) {
+	last := len(row) - 1
+	for w := 0; w < last; w++ {
+		out[w] = row[w]>>1 | row[w+1]<<63
+	}
+	out[last] = row[last] >> 1
+	edge := uint((ImageWidth - 1) % 64)
+	out[last] = out[last]&^(1<<edge) | edgeNeighbour(row, ImageWidth, boundary, ImageWidth)<<edge
+}
+
+// edgeNeighbour is 1 if cell j of the row, which is just past the west or east edge, is alive
+func edgeNeighbour(row []uint64, ImageWidth int, boundary util.Boundary, j int) uint64 {
+	j, _, ok := boundary.Index(j, ImageWidth, false)
+	if !ok {
+		return 0
+	}
+	return row[j/64] >> uint(j%64) & 1
+}
+
+// lastWordMask has a bit set for each cell in the last word of a row
+func lastWordMask(ImageWidth int) uint64 {
+	if ImageWidth%64 == 0 {
+		return ^uint64(0)
+	}
+	return 1<<uint(ImageWidth%64) - 1
+}
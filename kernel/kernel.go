@@ -0,0 +1,73 @@
+package kernel
+
+import "uk.ac.bris.cs/gameoflife/util"
+
+// UpdateCells calculates the next state of rows startIndex (inclusive) to endIndex (exclusive) of the world under the rule and sends them down rowsChan.
+// the boundary says what the cells on the edges of the world have as neighbours past them.
+// It is shared by the servers and the broker, which falls back to it when no server is able to process a slice
+func UpdateCells(world util.BitBoard, startIndex, endIndex int, rule Rule, boundary util.Boundary, rowsChan chan [][]uint64) {
+	//rule tables look at the state of each neighbour rather than counting them
+	if rule.Table != nil {
+		updateCellsTable(world, startIndex, endIndex, rule, boundary, rowsChan)
+		return
+	}
+	//Larger than Life rules count a bigger box around each cell, which is done with a summed-area table
+	if rule.Radius > 1 {
+		updateCellsLargerThanLife(world, startIndex, endIndex, rule, boundary, rowsChan)
+		return
+	}
+	ImageWidth := world.Width
+
+	workerRows := make([][]uint64, endIndex-startIndex)
+	for i := startIndex; i < endIndex; i++ {
+		//i-startIndex because the startIndex may be something like 8, but workerRows starts at index 0
+		row := world.Rows[i]
+		//rows past a dead edge in a halo are outside the world, so they stay empty
+		if len(row) == 0 {
+			continue
+		}
+		newRow := make([]uint64, util.WordsPerRow(ImageWidth)*util.Planes(world.States))
+		rows := [3][]uint64{world.RowAt(i-1, boundary), row, world.RowAt(i+1, boundary)}
+		offsets := rule.Neighbourhood.offsets(world.FirstRow + i)
+
+		for j := 0; j < ImageWidth; j++ {
+			jBehind, _, behindOk := boundary.Index(j-1, ImageWidth, false)
+			jAhead, _, aheadOk := boundary.Index(j+1, ImageWidth, false)
+			//past a dead edge, the neighbours are always dead
+			if !behindOk {
+				jBehind = -1
+			}
+			if !aheadOk {
+				jAhead = -1
+			}
+
+			columns := [3]int{jBehind, j, jAhead}
+
+			liveNeighbours := 0
+			for _, o := range offsets {
+				liveNeighbours += cell(rows[o.dy+1], columns[o.dx+1])
+			}
+
+			//only alive cells count as neighbours, which are the ones in the first plane of each row
+			if world.States <= 2 {
+				if rule.Next(cell(row, j) == 1, liveNeighbours) {
+					newRow[j/64] |= 1 << uint(j%64)
+				}
+			} else {
+				state := util.RowState(row, j, ImageWidth, world.States)
+				util.SetRowState(newRow, j, ImageWidth, world.States, rule.NextState(state, liveNeighbours))
+			}
+		}
+		workerRows[i-startIndex] = newRow
+	}
+	rowsChan <- workerRows
+	return
+}
+
+// cell is 1 if cell j of the packed row is alive and 0 if it is dead. cells outside the world (j is -1 or the row is empty) are dead
+func cell(row []uint64, j int) int {
+	if j < 0 || len(row) == 0 {
+		return 0
+	}
+	return int(row[j/64] >> uint(j%64) & 1)
+}
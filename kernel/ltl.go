@@ -0,0 +1,79 @@
+package kernel
+
+import "uk.ac.bris.cs/gameoflife/util"
+
+// updateCellsLargerThanLife does the job of UpdateCells for rules with a radius above 1. the alive cells in each cell's box are counted
+// with a summed-area table, so every count takes the same four lookups however big the radius is.
+// the von Neumann diamond isn't a box, so it is counted a row at a time from the sums along each row instead
+func updateCellsLargerThanLife(world util.BitBoard, startIndex, endIndex int, rule Rule, boundary util.Boundary, rowsChan chan [][]uint64) {
+	ImageWidth := world.Width
+	radius := rule.Radius
+	size := 2*radius + 1
+
+	//the table covers rows startIndex-radius to endIndex+radius and columns -radius to ImageWidth+radius, with a row and column of zeroes
+	//in front, so table[y][x] is the number of alive cells above and to the left of (x, y) in that area
+	tableWidth := ImageWidth + 2*radius + 1
+	tableHeight := endIndex - startIndex + 2*radius + 1
+
+	//the columns of the area mapped back into the world, or -1 past a dead edge
+	columns := make([]int, tableWidth-1)
+	for x := range columns {
+		j, _, ok := boundary.Index(x-radius, ImageWidth, false)
+		if !ok {
+			j = -1
+		}
+		columns[x] = j
+	}
+
+	//rowSums[y][x] is the number of alive cells to the left of (x, y) along its row
+	table := make([][]int32, tableHeight)
+	rowSums := make([][]int32, tableHeight)
+	table[0] = make([]int32, tableWidth)
+	for y := 1; y < tableHeight; y++ {
+		row := world.RowAt(startIndex-radius+y-1, boundary)
+		table[y] = make([]int32, tableWidth)
+		rowSums[y] = make([]int32, tableWidth)
+		for x, j := range columns {
+			rowSums[y][x+1] = rowSums[y][x] + int32(cell(row, j))
+			table[y][x+1] = table[y-1][x+1] + rowSums[y][x+1]
+		}
+	}
+
+	workerRows := make([][]uint64, endIndex-startIndex)
+	for i := startIndex; i < endIndex; i++ {
+		row := world.Rows[i]
+		//rows past a dead edge in a halo are outside the world, so they stay empty
+		if len(row) == 0 {
+			continue
+		}
+		newRow := make([]uint64, util.WordsPerRow(ImageWidth)*util.Planes(world.States))
+		//the box around cell (j, i) is rows y to y+size and columns j to j+size of the table
+		y := i - startIndex
+		for j := 0; j < ImageWidth; j++ {
+			var count int
+			if rule.Neighbourhood == VonNeumann {
+				//the diamond's rows get narrower the further they are from the middle
+				for dy := -radius; dy <= radius; dy++ {
+					reach := radius - dy
+					if dy < 0 {
+						reach = radius + dy
+					}
+					sums := rowSums[y+radius+dy+1]
+					count += int(sums[j+radius+reach+1] - sums[j+radius-reach])
+				}
+			} else {
+				count = int(table[y+size][j+size] - table[y][j+size] - table[y+size][j] + table[y][j])
+			}
+			state := util.RowState(row, j, ImageWidth, world.States)
+			if state == 1 && !rule.Middle {
+				count--
+			}
+			if next := rule.NextState(state, count); next != 0 {
+				util.SetRowState(newRow, j, ImageWidth, world.States, next)
+			}
+		}
+		workerRows[i-startIndex] = newRow
+	}
+	rowsChan <- workerRows
+	return
+}
@@ -0,0 +1,81 @@
+package kernel
+
+import "fmt"
+
+// Neighbourhood says which cells around a cell count as its neighbours
+type Neighbourhood int
+
+const (
+	// Moore is the 8 cells around, or the whole box for Larger than Life rules
+	Moore Neighbourhood = iota
+	// VonNeumann is the 4 cells above, below and to either side, or the diamond of cells within Radius steps for Larger than Life rules
+	VonNeumann
+	// Hex lays the cells out as a hexagonal grid, with every odd row shifted half a cell to the east of the even rows,
+	// so each cell has 6 neighbours: 2 beside it, 2 above and 2 below
+	Hex
+)
+
+var neighbourhoodNames = []string{"moore", "vonneumann", "hex"}
+
+// ParseNeighbourhood reads a neighbourhood by name: moore, vonneumann or hex. the empty string is Moore
+func ParseNeighbourhood(neighbourhood string) (Neighbourhood, error) {
+	if neighbourhood == "" {
+		return Moore, nil
+	}
+	for n, name := range neighbourhoodNames {
+		if neighbourhood == name {
+			return Neighbourhood(n), nil
+		}
+	}
+	return Moore, fmt.Errorf("unknown neighbourhood %q, expected moore, vonneumann or hex", neighbourhood)
+}
+
+func (n Neighbourhood) String() string {
+	return neighbourhoodNames[n]
+}
+
+// offset is where a neighbour is, relative to the cell
+type offset struct {
+	dx, dy int
+}
+
+var mooreOffsets = []offset{{-1, -1}, {0, -1}, {1, -1}, {-1, 0}, {1, 0}, {-1, 1}, {0, 1}, {1, 1}}
+var vonNeumannOffsets = []offset{{0, -1}, {-1, 0}, {1, 0}, {0, 1}}
+
+// the rows above and below an even row are shifted east of it, so its neighbours in them are the cell straight up or down and the one to the west.
+// for an odd row, they are the cell straight up or down and the one to the east
+var hexOffsets = [2][]offset{
+	{{-1, -1}, {0, -1}, {-1, 0}, {1, 0}, {-1, 1}, {0, 1}},
+	{{0, -1}, {1, -1}, {-1, 0}, {1, 0}, {0, 1}, {1, 1}},
+}
+
+// offsets are where the neighbours of a cell in a row of the world are. only Hex depends on the row
+func (n Neighbourhood) offsets(row int) []offset {
+	switch n {
+	case VonNeumann:
+		return vonNeumannOffsets
+	case Hex:
+		return hexOffsets[row&1]
+	}
+	return mooreOffsets
+}
+
+// the neighbours in the order rule tables list them, clockwise from north. a hexagonal grid has no neighbour straight north,
+// so its ring starts at the one to the north-east, as Golly's does
+var mooreRing = []offset{{0, -1}, {1, -1}, {1, 0}, {1, 1}, {0, 1}, {-1, 1}, {-1, 0}, {-1, -1}}
+var vonNeumannRing = []offset{{0, -1}, {1, 0}, {0, 1}, {-1, 0}}
+var hexRings = [2][]offset{
+	{{0, -1}, {1, 0}, {0, 1}, {-1, 1}, {-1, 0}, {-1, -1}},
+	{{1, -1}, {1, 0}, {1, 1}, {0, 1}, {-1, 0}, {0, -1}},
+}
+
+// ring is offsets in the order rule tables list the neighbours in
+func (n Neighbourhood) ring(row int) []offset {
+	switch n {
+	case VonNeumann:
+		return vonNeumannRing
+	case Hex:
+		return hexRings[row&1]
+	}
+	return mooreRing
+}
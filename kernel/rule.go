@@ -0,0 +1,308 @@
+package kernel
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Rule says how many alive neighbours (0 to 8) make a dead cell be born, and how many let an alive cell survive.
+// bit n of Birth or Survival is set if n neighbours does.
+//
+// States is the number of states a cell can be in. for Generations rules it is more than 2, and an alive cell that doesn't survive
+// isn't dead straight away, but goes through states 2, 3... States-1 (one per turn) before dying. only dead cells can be born
+//
+// Radius is how far the neighbourhood reaches. it is 1 for the 8 cells around, and more for Larger than Life rules, which count the alive cells
+// in the (2*Radius+1) by (2*Radius+1) box around a cell (including the cell itself if Middle is set), and give the counts that make a cell
+// be born or survive as the ranges BirthMin to BirthMax and SurvivalMin to SurvivalMax instead of Birth and Survival
+//
+// Neighbourhood is which of the cells around count. it is Moore unless the rule says otherwise, by ending its survivals with V (von Neumann)
+// or H (hexagonal) as Golly does, e.g. B2/S34H, or with NN for a Larger than Life rule
+//
+// Table is set for rules given as a rule table, which say what each cell's next state is from its own state and the state of each of
+// its neighbours rather than from a count, such as Wireworld. States and Neighbourhood come from the table, and the rest is unused
+type Rule struct {
+	Birth         uint16
+	Survival      uint16
+	States        int
+	Neighbourhood Neighbourhood
+	Table         *Table
+
+	Radius      int
+	Middle      bool
+	BirthMin    int
+	BirthMax    int
+	SurvivalMin int
+	SurvivalMax int
+}
+
+// Conway is the Game of Life rule, B3/S23, used when no rule is given
+var Conway = Rule{Birth: 1 << 3, Survival: 1<<2 | 1<<3, States: 2, Radius: 1}
+
+// ParseRule reads a rule in B/S notation, such as B36/S23 (HighLife) or B2/S (Seeds), or B/S/C notation for Generations rules,
+// such as B2/S/C3 (Brian's Brain) or B2/S345/C4 (Star Wars). Larger than Life rules are read in the notation Golly uses,
+// such as R5,C0,M1,S34..58,B34..45,NM (Bosco's rule). anything else, such as Wireworld, is the name of a rule table in TableDir.
+// the empty string is Conway
+func ParseRule(rule string) (Rule, error) {
+	if rule == "" {
+		return Conway, nil
+	}
+	//both notations split the rule into parts, which names can't
+	if !strings.ContainsAny(rule, "/,") {
+		table, err := LoadTable(rule)
+		if err != nil {
+			return Rule{}, fmt.Errorf("rule %q is not in B/S notation, e.g. B3/S23, so it has to be a rule table: %v", rule, err)
+		}
+		return Rule{States: table.States, Neighbourhood: table.Neighbourhood, Radius: 1, Table: table}, nil
+	}
+	if strings.HasPrefix(strings.ToUpper(rule), "R") {
+		return parseLargerThanLife(rule)
+	}
+	parts := strings.Split(strings.ToUpper(rule), "/")
+	if len(parts) < 2 || len(parts) > 3 || !strings.HasPrefix(parts[0], "B") || !strings.HasPrefix(parts[1], "S") {
+		return Rule{}, fmt.Errorf("rule %q is not in B/S notation, e.g. B3/S23", rule)
+	}
+	states := 2
+	if len(parts) == 3 {
+		_, err := fmt.Sscanf(parts[2], "C%d", &states)
+		if err != nil || states < 2 || fmt.Sprintf("C%d", states) != parts[2] {
+			return Rule{}, fmt.Errorf("rule %q: %q is not a number of states, e.g. C3", rule, parts[2])
+		}
+	}
+	neighbourhood := Moore
+	if strings.HasSuffix(parts[1], "V") {
+		neighbourhood = VonNeumann
+	} else if strings.HasSuffix(parts[1], "H") {
+		neighbourhood = Hex
+	}
+	if neighbourhood != Moore {
+		parts[1] = parts[1][:len(parts[1])-1]
+	}
+	birth, err := parseCounts(parts[0][1:])
+	if err != nil {
+		return Rule{}, fmt.Errorf("rule %q: %v", rule, err)
+	}
+	survival, err := parseCounts(parts[1][1:])
+	if err != nil {
+		return Rule{}, fmt.Errorf("rule %q: %v", rule, err)
+	}
+	return Rule{Birth: birth, Survival: survival, States: states, Neighbourhood: neighbourhood, Radius: 1}, nil
+}
+
+// parseLargerThanLife reads a rule such as R5,C0,M1,S34..58,B34..45,NM: the radius, the number of states (0 or 2 for alive and dead),
+// whether the middle cell is counted, the survival and birth ranges, and the neighbourhood, which is NM for the Moore box or NN for the von Neumann diamond.
+// a radius 1 rule is turned into the B/S rule it is the same as
+func parseLargerThanLife(rule string) (Rule, error) {
+	parts := strings.Split(strings.ToUpper(strings.ReplaceAll(rule, " ", "")), ",")
+	r := Rule{States: 2}
+	seen := make(map[byte]bool)
+	for _, part := range parts {
+		if part == "" {
+			return Rule{}, fmt.Errorf("rule %q has an empty part", rule)
+		}
+		key, value := part[0], part[1:]
+		if seen[key] {
+			return Rule{}, fmt.Errorf("rule %q gives %c more than once", rule, key)
+		}
+		seen[key] = true
+
+		var err error
+		switch key {
+		case 'R':
+			r.Radius, err = parseNumber(value)
+			if err == nil && r.Radius < 1 {
+				err = fmt.Errorf("the radius has to be at least 1")
+			}
+		case 'C':
+			r.States, err = parseNumber(value)
+			if r.States < 2 {
+				r.States = 2
+			}
+		case 'M':
+			var middle int
+			middle, err = parseNumber(value)
+			if err == nil && middle > 1 {
+				err = fmt.Errorf("M has to be 0 or 1")
+			}
+			r.Middle = middle == 1
+		case 'S':
+			r.SurvivalMin, r.SurvivalMax, err = parseRange(value)
+		case 'B':
+			r.BirthMin, r.BirthMax, err = parseRange(value)
+		case 'N':
+			switch value {
+			case "M":
+				r.Neighbourhood = Moore
+			case "N":
+				r.Neighbourhood = VonNeumann
+			default:
+				err = fmt.Errorf("the neighbourhood has to be NM (Moore) or NN (von Neumann)")
+			}
+		default:
+			err = fmt.Errorf("%q is not part of Larger than Life notation, e.g. R5,C0,M1,S34..58,B34..45,NM", part)
+		}
+		if err != nil {
+			return Rule{}, fmt.Errorf("rule %q: %v", rule, err)
+		}
+	}
+	if !seen['R'] || !seen['S'] || !seen['B'] {
+		return Rule{}, fmt.Errorf("rule %q needs a radius, survival range and birth range, e.g. R5,C0,M1,S34..58,B34..45,NM", rule)
+	}
+
+	if r.Radius == 1 {
+		//the counts for alive cells include themselves when the middle is counted, so they are one more than their number of neighbours
+		offset := 0
+		if r.Middle {
+			offset = 1
+		}
+		for n := 0; n < len(r.Neighbourhood.offsets(0))+1; n++ {
+			if n >= r.BirthMin && n <= r.BirthMax {
+				r.Birth |= 1 << uint(n)
+			}
+			if n+offset >= r.SurvivalMin && n+offset <= r.SurvivalMax {
+				r.Survival |= 1 << uint(n)
+			}
+		}
+		return Rule{Birth: r.Birth, Survival: r.Survival, States: r.States, Neighbourhood: r.Neighbourhood, Radius: 1}, nil
+	}
+	return r, nil
+}
+
+// WithNeighbourhood returns the rule using a neighbourhood. a rule that already says which neighbourhood it uses has to agree,
+// and Larger than Life rules can't be hexagonal. a rule table's transitions are written for its own neighbourhood, so it can't be changed
+func (r Rule) WithNeighbourhood(neighbourhood Neighbourhood) (Rule, error) {
+	if r.Table != nil && r.Neighbourhood != neighbourhood {
+		return Rule{}, fmt.Errorf("rule table %v is for the %v neighbourhood, not %v", r.Table.Name, r.Neighbourhood, neighbourhood)
+	}
+	if r.Neighbourhood != Moore && r.Neighbourhood != neighbourhood {
+		return Rule{}, fmt.Errorf("rule %v is for the %v neighbourhood, not %v", r, r.Neighbourhood, neighbourhood)
+	}
+	if r.Radius > 1 && neighbourhood == Hex {
+		return Rule{}, fmt.Errorf("rule %v has a radius above 1, which only works with the moore and vonneumann neighbourhoods", r)
+	}
+	r.Neighbourhood = neighbourhood
+	return r, nil
+}
+
+// parseNumber reads a whole number that isn't negative
+func parseNumber(number string) (int, error) {
+	n, err := strconv.Atoi(number)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("%q is not a number", number)
+	}
+	return n, nil
+}
+
+// parseRange reads a range of counts such as 34..58, or a single count such as 3
+func parseRange(counts string) (int, int, error) {
+	bounds := strings.Split(counts, "..")
+	if len(bounds) > 2 {
+		return 0, 0, fmt.Errorf("%q is not a range, e.g. 34..58", counts)
+	}
+	min, err := parseNumber(bounds[0])
+	if err != nil {
+		return 0, 0, err
+	}
+	max := min
+	if len(bounds) == 2 {
+		max, err = parseNumber(bounds[1])
+		if err != nil {
+			return 0, 0, err
+		}
+	}
+	if min > max {
+		return 0, 0, fmt.Errorf("%q is not a range, as it ends before it starts", counts)
+	}
+	return min, max, nil
+}
+
+// parseCounts turns a list of neighbour counts such as "23" into a bit mask
+func parseCounts(counts string) (uint16, error) {
+	var mask uint16
+	for _, c := range counts {
+		if c < '0' || c > '8' {
+			return 0, fmt.Errorf("%q is not a number of neighbours", c)
+		}
+		mask |= 1 << uint(c-'0')
+	}
+	return mask, nil
+}
+
+// String writes the rule back out in B/S notation, Larger than Life notation if it has a radius above 1, or as its name if it is a rule table
+func (r Rule) String() string {
+	if r.Table != nil {
+		return r.Table.Name
+	}
+	if r.Radius > 1 {
+		states, middle := 0, 0
+		if r.States > 2 {
+			states = r.States
+		}
+		if r.Middle {
+			middle = 1
+		}
+		neighbourhood := "M"
+		if r.Neighbourhood == VonNeumann {
+			neighbourhood = "N"
+		}
+		return fmt.Sprintf("R%d,C%d,M%d,S%d..%d,B%d..%d,N%s", r.Radius, states, middle, r.SurvivalMin, r.SurvivalMax, r.BirthMin, r.BirthMax, neighbourhood)
+	}
+	var b strings.Builder
+	b.WriteString("B")
+	for n := 0; n <= 8; n++ {
+		if r.Birth>>uint(n)&1 == 1 {
+			fmt.Fprint(&b, n)
+		}
+	}
+	b.WriteString("/S")
+	for n := 0; n <= 8; n++ {
+		if r.Survival>>uint(n)&1 == 1 {
+			fmt.Fprint(&b, n)
+		}
+	}
+	switch r.Neighbourhood {
+	case VonNeumann:
+		b.WriteString("V")
+	case Hex:
+		b.WriteString("H")
+	}
+	if r.States > 2 {
+		fmt.Fprintf(&b, "/C%d", r.States)
+	}
+	return b.String()
+}
+
+// Next is whether a cell is alive next turn, given whether it is alive (or, for a Generations rule, dead) now and its number of alive neighbours.
+// for Larger than Life rules, liveNeighbours is the count over the whole box, so it includes the cell itself if Middle is set
+func (r Rule) Next(alive bool, liveNeighbours int) bool {
+	if r.Radius > 1 {
+		if alive {
+			return liveNeighbours >= r.SurvivalMin && liveNeighbours <= r.SurvivalMax
+		}
+		return liveNeighbours >= r.BirthMin && liveNeighbours <= r.BirthMax
+	}
+	if alive {
+		return r.Survival>>uint(liveNeighbours)&1 == 1
+	}
+	return r.Birth>>uint(liveNeighbours)&1 == 1
+}
+
+// NextState is the state a cell will be in next turn, given its state now and its number of alive neighbours
+func (r Rule) NextState(state, liveNeighbours int) int {
+	switch {
+	case state == 0:
+		if r.Next(false, liveNeighbours) {
+			return 1
+		}
+		return 0
+	case state == 1:
+		if r.Next(true, liveNeighbours) {
+			return 1
+		}
+	}
+	//alive cells that don't survive, and dying cells, move on a state until they run out of states and are dead
+	if state+1 < r.States {
+		return state + 1
+	}
+	return 0
+}
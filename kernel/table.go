@@ -0,0 +1,438 @@
+package kernel
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+
+	"uk.ac.bris.cs/gameoflife/util"
+)
+
+// TableDir is the folder rule tables are loaded from. a table called name is the file name.rule in it
+var TableDir = "rules"
+
+// Table is a cellular automaton given as a list of transitions rather than by counting neighbours, read from the @TABLE section
+// of a rule file in the format Golly uses. each transition lists the states the cell and each of its neighbours (clockwise from north)
+// can be in, and the state the cell goes to if they are. the first transition that matches is used, and a cell that matches none stays as it is.
+//
+// the neighbours can be matched in more than one order, which the table gives as its symmetries: none, rotate2, rotate4 or rotate8
+// (turning the neighbours around the cell), reflect_horizontal, rotate4reflect or rotate8reflect (turning and flipping them),
+// rotate3, rotate6 or rotate6reflect for the hexagonal neighbourhood, or permute (any order at all)
+type Table struct {
+	Name          string
+	States        int
+	Neighbourhood Neighbourhood
+
+	transitions []transition
+	//the orders the neighbours are read in, as where in the ring each of them is read from. nil with permute
+	symmetries [][]int
+	permute    bool
+}
+
+// cellSet has bit s set for each state s that matches
+type cellSet [4]uint64
+
+func (c cellSet) has(state byte) bool {
+	return c[state/64]>>uint(state%64)&1 == 1
+}
+
+// transition is one line of a table. inputs[0] is the states the cell matches and the rest are its neighbours in ring order.
+// a variable used more than once has to be the same state every time, so same[k] is the first input with the same variable as input k,
+// or -1 if it is the first. the next state is output, or the state of input outputFrom if that isn't -1
+type transition struct {
+	inputs     []cellSet
+	same       []int
+	output     byte
+	outputFrom int
+}
+
+// the tables that have been loaded, so servers don't read them again every turn
+var tables = struct {
+	sync.Mutex
+	loaded map[string]*Table
+}{loaded: make(map[string]*Table)}
+
+// table names are used as file names by the servers, so they can't reach out of TableDir
+var tableName = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// LoadTable reads the rule table called name from TableDir. it is only read once, so changes to the file need a restart to be seen
+func LoadTable(name string) (*Table, error) {
+	if !tableName.MatchString(name) {
+		return nil, fmt.Errorf("%q is not a rule table name, which can only have letters, digits, _ and -", name)
+	}
+	path := filepath.Join(TableDir, name+".rule")
+	tables.Lock()
+	defer tables.Unlock()
+	if table, ok := tables.loaded[path]; ok {
+		return table, nil
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("no rule table %v: %v", name, err)
+	}
+	defer file.Close()
+	table, err := ReadTable(name, file)
+	if err != nil {
+		return nil, err
+	}
+	tables.loaded[path] = table
+	return table, nil
+}
+
+// ReadTable reads a rule table in Golly's format. if the file is split into @ sections, only @TABLE is read.
+// the table is called name, whatever its @RULE line says, as that is what the servers will load it by
+func ReadTable(name string, r io.Reader) (*Table, error) {
+	table := &Table{Name: name}
+	variables := make(map[string]cellSet)
+	symmetries := "none"
+	sections, inTable := false, false
+	seenTable := false
+
+	scanner := bufio.NewScanner(r)
+	for number := 1; scanner.Scan(); number++ {
+		line := scanner.Text()
+		if comment := strings.Index(line, "#"); comment >= 0 {
+			line = line[:comment]
+		}
+		line = strings.TrimSpace(line)
+		if strings.HasPrefix(line, "@") {
+			sections = true
+			inTable = strings.Fields(line)[0] == "@TABLE"
+			seenTable = seenTable || inTable
+			continue
+		}
+		if line == "" || sections && !inTable {
+			continue
+		}
+
+		var err error
+		switch {
+		case strings.HasPrefix(line, "n_states:"):
+			table.States, err = parseNumber(strings.TrimSpace(strings.TrimPrefix(line, "n_states:")))
+			if err == nil && (table.States < 2 || table.States > 256) {
+				err = fmt.Errorf("n_states has to be 2 to 256")
+			}
+		case strings.HasPrefix(line, "neighborhood:"), strings.HasPrefix(line, "neighbourhood:"):
+			if len(table.transitions) > 0 {
+				err = fmt.Errorf("the neighbourhood has to come before the transitions")
+				break
+			}
+			neighbourhood := strings.ToLower(strings.TrimSpace(line[strings.Index(line, ":")+1:]))
+			if neighbourhood == "hexagonal" {
+				neighbourhood = "hex"
+			}
+			table.Neighbourhood, err = ParseNeighbourhood(neighbourhood)
+		case strings.HasPrefix(line, "symmetries:"):
+			symmetries = strings.TrimSpace(strings.TrimPrefix(line, "symmetries:"))
+		case table.States == 0:
+			err = fmt.Errorf("n_states has to come before the variables and transitions")
+		case strings.HasPrefix(line, "var "), strings.HasPrefix(line, "var\t"):
+			err = table.parseVariable(strings.TrimSpace(line[4:]), variables)
+		default:
+			var t transition
+			t, err = table.parseTransition(line, variables)
+			table.transitions = append(table.transitions, t)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("rule table %v line %d: %v", name, number, err)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("rule table %v: %v", name, err)
+	}
+	if sections && !seenTable {
+		return nil, fmt.Errorf("rule table %v has no @TABLE section, which is the only kind of rule that can be run", name)
+	}
+	if table.States == 0 {
+		return nil, fmt.Errorf("rule table %v doesn't say its n_states", name)
+	}
+	var err error
+	if table.symmetries, table.permute, err = symmetryOrders(symmetries, table.Neighbourhood); err != nil {
+		return nil, fmt.Errorf("rule table %v: %v", name, err)
+	}
+	return table, nil
+}
+
+// parseVariable reads a variable such as a={0,1,2}, which can include the states of variables before it, e.g. b={a,3}
+func (t *Table) parseVariable(variable string, variables map[string]cellSet) error {
+	parts := strings.SplitN(variable, "=", 2)
+	if len(parts) != 2 {
+		return fmt.Errorf("%q is not a variable, e.g. var a={0,1,2}", variable)
+	}
+	name := strings.TrimSpace(parts[0])
+	if !tableName.MatchString(name) {
+		return fmt.Errorf("%q is not a variable name", name)
+	}
+	if _, err := strconv.Atoi(name); err == nil {
+		return fmt.Errorf("variable %q can't be a number", name)
+	}
+	set, _, err := t.parseStates(strings.ReplaceAll(parts[1], " ", ""), variables)
+	if err != nil {
+		return err
+	}
+	variables[name] = set
+	return nil
+}
+
+// parseStates reads a state, a variable or a set of them in braces, and says whether it was a variable on its own
+func (t *Table) parseStates(states string, variables map[string]cellSet) (cellSet, bool, error) {
+	var set cellSet
+	if strings.HasPrefix(states, "{") && strings.HasSuffix(states, "}") {
+		for _, element := range strings.Split(states[1:len(states)-1], ",") {
+			elementSet, _, err := t.parseStates(element, variables)
+			if err != nil {
+				return cellSet{}, false, err
+			}
+			for w := range set {
+				set[w] |= elementSet[w]
+			}
+		}
+		return set, false, nil
+	}
+	if variable, ok := variables[states]; ok {
+		return variable, true, nil
+	}
+	state, err := parseNumber(states)
+	if err != nil {
+		return cellSet{}, false, fmt.Errorf("%q is not a state or a variable", states)
+	}
+	if state >= t.States {
+		return cellSet{}, false, fmt.Errorf("state %d is past n_states", state)
+	}
+	set[state/64] |= 1 << uint(state%64)
+	return set, false, nil
+}
+
+// parseTransition reads a transition, such as 1,a,b,c,d,e,f,g,h,2, or 0123400 without commas when every state and variable is one character
+func (t *Table) parseTransition(line string, variables map[string]cellSet) (transition, error) {
+	line = strings.Join(strings.Fields(line), "")
+	var tokens []string
+	if strings.ContainsAny(line, ",{") {
+		depth, start := 0, 0
+		for i, c := range line {
+			switch c {
+			case '{':
+				depth++
+			case '}':
+				depth--
+			case ',':
+				if depth == 0 {
+					tokens = append(tokens, line[start:i])
+					start = i + 1
+				}
+			}
+		}
+		tokens = append(tokens, line[start:])
+	} else {
+		tokens = strings.Split(line, "")
+	}
+	neighbours := len(t.Neighbourhood.ring(0))
+	if len(tokens) != neighbours+2 {
+		return transition{}, fmt.Errorf("a %v transition has %d states, the cell, its %d neighbours and its next state, not %d", t.Neighbourhood, neighbours+2, neighbours, len(tokens))
+	}
+
+	tr := transition{outputFrom: -1}
+	first := make(map[string]int)
+	for k, token := range tokens[:len(tokens)-1] {
+		set, isVariable, err := t.parseStates(token, variables)
+		if err != nil {
+			return transition{}, err
+		}
+		same := -1
+		if isVariable {
+			if f, ok := first[token]; ok {
+				same = f
+			} else {
+				first[token] = k
+			}
+		}
+		tr.inputs = append(tr.inputs, set)
+		tr.same = append(tr.same, same)
+	}
+	output := tokens[len(tokens)-1]
+	if f, ok := first[output]; ok {
+		tr.outputFrom = f
+		return tr, nil
+	}
+	state, err := parseNumber(output)
+	if err != nil || state >= t.States {
+		return transition{}, fmt.Errorf("the next state %q has to be a state, or a variable used earlier in the transition", output)
+	}
+	tr.output = byte(state)
+	return tr, nil
+}
+
+// the turns a symmetry allows, as the number of ways the ring of neighbours can be turned, and whether it can be flipped over too
+var symmetryNames = map[string]struct {
+	rotations int
+	reflect   bool
+}{
+	"none":               {1, false},
+	"rotate2":            {2, false},
+	"rotate3":            {3, false},
+	"rotate4":            {4, false},
+	"rotate6":            {6, false},
+	"rotate8":            {8, false},
+	"reflect_horizontal": {1, true},
+	"rotate4reflect":     {4, true},
+	"rotate6reflect":     {6, true},
+	"rotate8reflect":     {8, true},
+}
+
+// symmetryOrders lists the orders the neighbours can be read in for a symmetry, or says to try every order for permute
+func symmetryOrders(symmetry string, neighbourhood Neighbourhood) ([][]int, bool, error) {
+	if symmetry == "permute" {
+		return nil, true, nil
+	}
+	size := len(neighbourhood.ring(0))
+	s, ok := symmetryNames[symmetry]
+	//a ring can only be turned by whole neighbours, and the hexagonal ring's flip doesn't go through north, so it has to come with every turn
+	if !ok || size%s.rotations != 0 || neighbourhood == Hex && s.reflect && s.rotations != 6 {
+		return nil, false, fmt.Errorf("symmetries %q can't be used with the %v neighbourhood", symmetry, neighbourhood)
+	}
+	var orders [][]int
+	for turn := 0; turn < size; turn += size / s.rotations {
+		for flip := 0; flip < 2; flip++ {
+			if flip == 1 && !s.reflect {
+				continue
+			}
+			order := make([]int, size)
+			for k := range order {
+				if flip == 1 {
+					order[k] = (size - k + turn) % size
+				} else {
+					order[k] = (k + turn) % size
+				}
+			}
+			orders = append(orders, order)
+		}
+	}
+	return orders, false, nil
+}
+
+// next is the state a cell goes to, given its state and then its neighbours' states in ring order
+func (t *Table) next(cells []byte) byte {
+	//where each input of a transition is read from in cells
+	pos := make([]int, len(cells))
+	for _, tr := range t.transitions {
+		if !tr.fits(cells, pos, 0, 0) {
+			continue
+		}
+		matched := false
+		if t.permute {
+			matched = tr.matchAnyOrder(cells, pos, make([]bool, len(cells)), 1)
+		} else {
+			for _, order := range t.symmetries {
+				if matched = tr.matchOrder(cells, pos, order); matched {
+					break
+				}
+			}
+		}
+		if matched {
+			if tr.outputFrom >= 0 {
+				return cells[pos[tr.outputFrom]]
+			}
+			return tr.output
+		}
+	}
+	return cells[0]
+}
+
+// fits is whether input k of the transition matches cells[c], given where the inputs before it were read from
+func (tr transition) fits(cells []byte, pos []int, k, c int) bool {
+	state := cells[c]
+	if !tr.inputs[k].has(state) {
+		return false
+	}
+	if tr.same[k] >= 0 && cells[pos[tr.same[k]]] != state {
+		return false
+	}
+	pos[k] = c
+	return true
+}
+
+// matchOrder matches the neighbours read in one order
+func (tr transition) matchOrder(cells []byte, pos []int, order []int) bool {
+	for k, ring := range order {
+		if !tr.fits(cells, pos, k+1, ring+1) {
+			return false
+		}
+	}
+	return true
+}
+
+// matchAnyOrder matches inputs k onwards to the neighbours not used yet, trying each neighbour that fits until the rest match too
+func (tr transition) matchAnyOrder(cells []byte, pos []int, used []bool, k int) bool {
+	if k == len(tr.inputs) {
+		return true
+	}
+	for c := 1; c < len(cells); c++ {
+		if used[c] || !tr.fits(cells, pos, k, c) {
+			continue
+		}
+		used[c] = true
+		if tr.matchAnyOrder(cells, pos, used, k+1) {
+			return true
+		}
+		used[c] = false
+	}
+	return false
+}
+
+// updateCellsTable does the job of UpdateCells for rule tables. the next state depends on the state of every neighbour,
+// so it can't be worked out from a count. each cell and its neighbours are looked up in the table instead, and the answers
+// are remembered, as most cells of a world are in one of only a few situations
+func updateCellsTable(world util.BitBoard, startIndex, endIndex int, rule Rule, boundary util.Boundary, rowsChan chan [][]uint64) {
+	table := rule.Table
+	ImageWidth := world.Width
+	seen := make(map[[9]byte]byte)
+
+	workerRows := make([][]uint64, endIndex-startIndex)
+	for i := startIndex; i < endIndex; i++ {
+		row := world.Rows[i]
+		//rows past a dead edge in a halo are outside the world, so they stay empty
+		if len(row) == 0 {
+			continue
+		}
+		newRow := make([]uint64, util.WordsPerRow(ImageWidth)*util.Planes(world.States))
+		rows := [3][]uint64{world.RowAt(i-1, boundary), row, world.RowAt(i+1, boundary)}
+		ring := table.Neighbourhood.ring(world.FirstRow + i)
+
+		for j := 0; j < ImageWidth; j++ {
+			var columns [3]int
+			for dx := -1; dx <= 1; dx++ {
+				column, _, ok := boundary.Index(j+dx, ImageWidth, false)
+				//past a dead edge, the neighbours are always dead
+				if !ok {
+					column = -1
+				}
+				columns[dx+1] = column
+			}
+
+			var cells [9]byte
+			cells[0] = byte(util.RowState(row, j, ImageWidth, world.States))
+			for k, o := range ring {
+				if neighbour := rows[o.dy+1]; len(neighbour) != 0 && columns[o.dx+1] >= 0 {
+					cells[k+1] = byte(util.RowState(neighbour, columns[o.dx+1], ImageWidth, world.States))
+				}
+			}
+			next, ok := seen[cells]
+			if !ok {
+				next = table.next(cells[:len(ring)+1])
+				seen[cells] = next
+			}
+			if next != 0 {
+				util.SetRowState(newRow, j, ImageWidth, world.States, int(next))
+			}
+		}
+		workerRows[i-startIndex] = newRow
+	}
+	rowsChan <- workerRows
+	return
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"uk.ac.bris.cs/gameoflife/gol"
+	"uk.ac.bris.cs/gameoflife/kernel"
+	"uk.ac.bris.cs/gameoflife/stubs"
+	"uk.ac.bris.cs/gameoflife/util"
+)
+
+// TestBitBoard checks packing and unpacking a world leaves it unchanged
+func TestBitBoard(t *testing.T) {
+	for _, size := range []int{16, 64, 512} {
+		for _, turns := range []int{0, 1, 100} {
+			path := fmt.Sprintf("check/images/%vx%vx%v.pgm", size, size, turns)
+			world := readWorld(path, size, size)
+			board := util.PackWorld(world)
+
+			expected := readAliveCells(path, size, size)
+			if board.Count() != len(expected) {
+				t.Errorf("%v: packed board has %v alive cells, expected %v", path, board.Count(), len(expected))
+			}
+			p := gol.Params{ImageWidth: size, ImageHeight: size, Turns: turns}
+			if !checkEqualBoard(board.AliveCells(), expected) {
+				boardFail(t, board.AliveCells(), expected, p)
+			}
+			unpacked := board.Unpack()
+			for y := range world {
+				for x := range world[y] {
+					if unpacked[y][x] != world[y][x] {
+						t.Fatalf("%v: cell (%v, %v) is %v after unpacking, expected %v", path, x, y, unpacked[y][x], world[y][x])
+					}
+				}
+			}
+		}
+	}
+}
+
+// TestKernel runs the packed kernel on its own, without a broker or servers, against the check images
+func TestKernel(t *testing.T) {
+	for _, size := range []int{16, 64, 512} {
+		board := util.PackWorld(readWorld(fmt.Sprintf("images/%vx%v.pgm", size, size), size, size))
+		rowsChan := make(chan [][]uint64, 1)
+		for turn := 1; turn <= 100; turn++ {
+			kernel.UpdateCells(board, 0, board.Height, kernel.Conway, util.Torus, rowsChan)
+			board.Rows = <-rowsChan
+			if turn != 1 && turn != 100 {
+				continue
+			}
+			expected := readAliveCells(fmt.Sprintf("check/images/%vx%vx%v.pgm", size, size, turn), size, size)
+			p := gol.Params{ImageWidth: size, ImageHeight: size, Turns: turn}
+			if !checkEqualBoard(board.AliveCells(), expected) {
+				boardFail(t, board.AliveCells(), expected, p)
+			}
+		}
+	}
+}
+
+// TestBitSlicedKernel checks the bit-sliced kernel against the cell by cell one, word for word, for 100 turns from every check image.
+// as well as whole worlds, it checks a slice in the middle of a world and a slice with a halo row either side, as the servers use them
+func TestBitSlicedKernel(t *testing.T) {
+	paths, err := filepath.Glob("check/images/*.pgm")
+	util.Check(err)
+	for _, path := range paths {
+		var width, height, turns int
+		fmt.Sscanf(filepath.Base(path), "%dx%dx%d.pgm", &width, &height, &turns)
+		board := util.PackWorld(readWorld(path, width, height))
+
+		t.Run(filepath.Base(path), func(t *testing.T) {
+			cellChan := make(chan [][]uint64, 1)
+			wordChan := make(chan [][]uint64, 1)
+			for turn := 1; turn <= 100; turn++ {
+				ranges := [][2]int{{0, height}, {height / 4, height / 2}}
+				halo := stubs.HaloRows(board, height/4, height/2, 1, util.Torus)
+				for _, r := range ranges {
+					kernel.UpdateCells(board, r[0], r[1], kernel.Conway, util.Torus, cellChan)
+					kernel.UpdateCellsBitSliced(board, r[0], r[1], kernel.Conway, util.Torus, wordChan)
+					compareRows(t, <-cellChan, <-wordChan, turn)
+				}
+				kernel.UpdateCells(halo, 1, halo.Height-1, kernel.Conway, util.Torus, cellChan)
+				kernel.UpdateCellsBitSliced(halo, 1, halo.Height-1, kernel.Conway, util.Torus, wordChan)
+				compareRows(t, <-cellChan, <-wordChan, turn)
+
+				kernel.UpdateCells(board, 0, height, kernel.Conway, util.Torus, cellChan)
+				board.Rows = <-cellChan
+			}
+		})
+	}
+}
+
+// compareRows fails the test at the first word that differs between the two kernels
+func compareRows(t *testing.T, cellRows, wordRows [][]uint64, turn int) {
+	for y := range cellRows {
+		for w := range cellRows[y] {
+			if cellRows[y][w] != wordRows[y][w] {
+				t.Fatalf("turn %v: row %v word %v is %064b, expected %064b", turn, y, w, wordRows[y][w], cellRows[y][w])
+			}
+		}
+	}
+}
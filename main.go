@@ -5,11 +5,15 @@ import (
 	"fmt"
 	"os"
 	"os/signal"
+	"path/filepath"
 	"runtime"
+	"strings"
 	"syscall"
 
 	"uk.ac.bris.cs/gameoflife/gol"
+	"uk.ac.bris.cs/gameoflife/kernel"
 	"uk.ac.bris.cs/gameoflife/sdl"
+	"uk.ac.bris.cs/gameoflife/util"
 )
 
 // main is the function called when starting Game of Life with 'go run .'
@@ -41,6 +45,95 @@ func main() {
 		10000000000,
 		"Specify the number of turns to process. Defaults to 10000000000.")
 
+	flag.StringVar(
+		&params.Engine,
+		"engine",
+		"",
+		"Specify the engine the broker should use: stitch, p2p or hashlife. Defaults to the broker's own default.")
+
+	flag.IntVar(
+		&params.TurnsPerBatch,
+		"batch",
+		0,
+		"Specify the number of turns the servers process per call. Defaults to the engine's own default.")
+
+	flag.StringVar(
+		&params.Rule,
+		"rule",
+		"",
+		"Specify the birth/survival rule in B/S notation, e.g. B36/S23, B/S/C for a Generations rule, e.g. B2/S/C3, Larger than Life notation, e.g. R5,C0,M1,S34..58,B34..45,NM, or the name of a rule table, e.g. Wireworld. Defaults to the rule of an RLE input or a checkpoint with -resume, or B3/S23.")
+
+	flag.StringVar(
+		&kernel.TableDir,
+		"rules",
+		"rules",
+		"Specify the folder to load rule tables from, as <name>.rule. The broker and servers have their own -rules. Defaults to rules.")
+
+	flag.StringVar(
+		&params.Boundary,
+		"boundary",
+		"",
+		"Specify what lies past the edges of the world: torus, dead, klein or mirror. Defaults to torus, or the checkpoint's boundary with -resume.")
+
+	flag.StringVar(
+		&params.Neighbourhood,
+		"neighbourhood",
+		"",
+		"Specify which cells around a cell count as its neighbours: moore, vonneumann or hex. Defaults to the one the rule gives, normally moore.")
+
+	flag.StringVar(
+		&params.InputPath,
+		"input",
+		"",
+		"Specify a PGM or PNG image, or a checkpoint, to start from, whose size is used instead of -w and -h, or an RLE, cells or Life 1.06 pattern to place in the middle of the world. Defaults to images/<h>x<w>.pgm.")
+
+	formats := flag.String(
+		"formats",
+		"pgm,rle",
+		"Specify the comma separated formats to write the world out in: "+strings.Join(gol.Formats, ", ")+". Defaults to pgm,rle.")
+
+	flag.IntVar(
+		&params.Scale,
+		"scale",
+		1,
+		"Specify how many pixels across each cell is in PNG output. Defaults to 1.")
+
+	flag.StringVar(
+		&params.OutputDir,
+		"out",
+		"out",
+		"Specify the folder to write the world out to. Defaults to out.")
+
+	flag.StringVar(
+		&params.NameTemplate,
+		"name-template",
+		gol.DefaultNameTemplate,
+		"Specify the name to write the world out under, with {width}, {height}, {turn}, {timestamp} and {rule} filled in. Defaults to "+gol.DefaultNameTemplate+".")
+
+	flag.IntVar(
+		&params.CheckpointTurns,
+		"checkpoint-turns",
+		0,
+		"Specify how many turns apart to write checkpoints of the world to the checkpoints folder inside -out. Defaults to 0, which doesn't.")
+
+	flag.DurationVar(
+		&params.CheckpointInterval,
+		"checkpoint-every",
+		0,
+		"Specify how long apart to write checkpoints of the world, e.g. 10m. Defaults to 0, which doesn't.")
+
+	flag.IntVar(
+		&params.CheckpointKeep,
+		"checkpoint-keep",
+		0,
+		"Specify how many of the newest checkpoints to keep. Defaults to 0, which keeps them all.")
+
+	flag.StringVar(
+		&params.Resume,
+		"resume",
+		"",
+		"Specify a checkpoint to carry on from, on the turn it was written on, with its size, engine, batch, rule and boundary. -w, -h, -engine, -batch, -rule, -neighbourhood and -boundary have to match it if they are given, and -turns is still the turn to end on.")
+
 	headless := flag.Bool(
 		"headless",
 		false,
@@ -48,10 +141,72 @@ func main() {
 
 	flag.Parse()
 
+	//a checkpoint has its own size, so -w and -h only have to match it if they are given
+	if params.Resume != "" {
+		given := make(map[string]bool)
+		flag.Visit(func(f *flag.Flag) { given[f.Name] = true })
+		if !given["w"] {
+			params.ImageWidth = 0
+		}
+		if !given["h"] {
+			params.ImageHeight = 0
+		}
+	}
+
+	params.OutputFormats = strings.Split(*formats, ",")
+	for _, format := range params.OutputFormats {
+		if !contains(gol.Formats, format) {
+			fmt.Printf("unknown format %q, expected %v\n", format, strings.Join(gol.Formats, ", "))
+			os.Exit(1)
+		}
+	}
+
+	if err := gol.CheckNameTemplate(params.NameTemplate); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+
+	params, err := gol.WithInput(params)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	rule, err := kernel.ParseRule(params.Rule)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	boundary, err := util.ParseBoundary(params.Boundary)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	if _, err := kernel.ParseNeighbourhood(params.Neighbourhood); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+
 	fmt.Printf("%-10v %v\n", "Threads", params.Threads)
 	fmt.Printf("%-10v %v\n", "Width", params.ImageWidth)
 	fmt.Printf("%-10v %v\n", "Height", params.ImageHeight)
 	fmt.Printf("%-10v %v\n", "Turns", params.Turns)
+	if params.Resume != "" {
+		fmt.Printf("%-10v %v from turn %v\n", "Resume", params.Resume, params.StartTurn)
+	} else if params.InputPath != "" {
+		fmt.Printf("%-10v %v\n", "Input", params.InputPath)
+	}
+	fmt.Printf("%-10v %v\n", "Output", filepath.Join(params.OutputDir, params.NameTemplate))
+	if params.CheckpointTurns > 0 {
+		fmt.Printf("%-10v every %v turns\n", "Checkpoint", params.CheckpointTurns)
+	}
+	if params.CheckpointInterval > 0 {
+		fmt.Printf("%-10v every %v\n", "Checkpoint", params.CheckpointInterval)
+	}
+	fmt.Printf("%-10v %v\n", "Rule", rule)
+	fmt.Printf("%-10v %v\n", "Boundary", boundary)
+	if params.Neighbourhood != "" {
+		fmt.Printf("%-10v %v\n", "Neighbourhood", params.Neighbourhood)
+	}
 
 	keyPresses := make(chan rune, 10)
 	events := make(chan gol.Event, 1000)
@@ -66,6 +221,16 @@ func main() {
 	}
 }
 
+// contains is whether the list has the string in it
+func contains(list []string, s string) bool {
+	for _, l := range list {
+		if l == s {
+			return true
+		}
+	}
+	return false
+}
+
 func sigterm(keyPresses chan<- rune) {
 	sigterm := make(chan os.Signal, 1)
 	signal.Notify(sigterm, syscall.SIGTERM, syscall.SIGINT)
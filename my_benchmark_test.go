@@ -1,10 +1,16 @@
 package main
 
 import (
+	"bytes"
+	"encoding/gob"
 	"fmt"
 	"os"
 	"testing"
+	"time"
 	"uk.ac.bris.cs/gameoflife/gol"
+	"uk.ac.bris.cs/gameoflife/kernel"
+	"uk.ac.bris.cs/gameoflife/stubs"
+	"uk.ac.bris.cs/gameoflife/util"
 )
 
 const benchLength = 1000
@@ -30,3 +36,125 @@ func BenchmarkGol(b *testing.B) {
 		})
 	}
 }
+
+// BenchmarkBatch measures how many turns per second the broker gets through on small boards, where the time is mostly spent
+// on rpc round trips, as the number of turns each server processes per call goes up
+func BenchmarkBatch(b *testing.B) {
+	os.Stdout = nil // Disable all program output apart from benchmark results
+	for _, size := range []int{16, 64} {
+		for _, batch := range []int{1, 4, 16} {
+			p := gol.Params{
+				Turns:         benchLength,
+				Threads:       1,
+				ImageWidth:    size,
+				ImageHeight:   size,
+				Engine:        "stitch",
+				TurnsPerBatch: batch,
+			}
+			name := fmt.Sprintf("%dx%dx%d-batch%d", p.ImageWidth, p.ImageHeight, p.Turns, p.TurnsPerBatch)
+			b.Run(name, func(b *testing.B) {
+				start := time.Now()
+				for i := 0; i < b.N; i++ {
+					events := make(chan gol.Event)
+					go gol.Run(p, events, nil)
+					for range events {
+
+					}
+				}
+				b.ReportMetric(float64(p.Turns*b.N)/time.Since(start).Seconds(), "turns/sec")
+			})
+		}
+	}
+}
+
+// BenchmarkKernel compares the cell by cell kernel against the bit-sliced one, updating the whole of 512x512 once per op
+func BenchmarkKernel(b *testing.B) {
+	world := util.PackWorld(readWorld("images/512x512.pgm", 512, 512))
+	kernels := map[string]func(util.BitBoard, int, int, kernel.Rule, util.Boundary, chan [][]uint64){
+		"cell":      kernel.UpdateCells,
+		"bitsliced": kernel.UpdateCellsBitSliced,
+	}
+	for _, name := range []string{"cell", "bitsliced"} {
+		updateCells := kernels[name]
+		b.Run(fmt.Sprintf("%dx%d-%s", world.Width, world.Height, name), func(b *testing.B) {
+			rowsChan := make(chan [][]uint64, 1)
+			for n := 0; n < b.N; n++ {
+				updateCells(world, 0, world.Height, kernel.Conway, util.Torus, rowsChan)
+				<-rowsChan
+			}
+		})
+	}
+}
+
+// BenchmarkProtocol compares the per-turn traffic of sending the whole world to every server (CalculateNextState)
+// against sending each server only its slice plus halo rows (CalculateNextSlice), on 512x512 split between 4 servers
+func BenchmarkProtocol(b *testing.B) {
+	const numberOfServers = 4
+	width, height := 512, 512
+	world := util.PackWorld(readWorld("images/512x512.pgm", width, height))
+
+	//for each protocol, how to build server i's request and something to decode it into
+	requests := map[string]func(i int) interface{}{
+		"full": func(i int) interface{} {
+			return stubs.ServerRequest{
+				World:        world,
+				ImageWidth:   width,
+				ImageHeight:  height,
+				NoOfServers:  numberOfServers,
+				ServerNumber: i,
+			}
+		},
+		"halo": func(i int) interface{} {
+			startIndex, endIndex := stubs.SliceBounds(height, numberOfServers, i)
+			return stubs.SliceRequest{
+				Rows:  stubs.HaloRows(world, startIndex, endIndex, 1, util.Torus),
+				Turns: 1,
+			}
+		},
+	}
+
+	targets := map[string]func() interface{}{
+		"full": func() interface{} { return new(stubs.ServerRequest) },
+		"halo": func() interface{} { return new(stubs.SliceRequest) },
+	}
+
+	for _, name := range []string{"full", "halo"} {
+		request, target := requests[name], targets[name]
+		b.Run(fmt.Sprintf("%dx%d-%s", width, height, name), func(b *testing.B) {
+			//one encoder and decoder per server, like a long lived rpc connection, so type information is only sent once
+			connections := make([]*bytes.Buffer, numberOfServers)
+			encoders := make([]*gob.Encoder, numberOfServers)
+			decoders := make([]*gob.Decoder, numberOfServers)
+			for i := range connections {
+				connections[i] = new(bytes.Buffer)
+				encoders[i] = gob.NewEncoder(connections[i])
+				decoders[i] = gob.NewDecoder(connections[i])
+			}
+
+			sent := 0
+			b.ResetTimer()
+			for n := 0; n < b.N; n++ {
+				for i := 0; i < numberOfServers; i++ {
+					before := connections[i].Len()
+					util.Check(encoders[i].Encode(request(i)))
+					sent += connections[i].Len() - before
+
+					util.Check(decoders[i].Decode(target()))
+				}
+			}
+			b.ReportMetric(float64(sent)/float64(b.N), "bytes/turn")
+		})
+	}
+}
+
+// readWorld loads a PGM image into a world
+func readWorld(path string, width, height int) [][]byte {
+	world := make([][]byte, height)
+	for i := range world {
+		world[i] = make([]byte, width)
+	}
+	for _, cell := range readAliveCells(path, width, height) {
+		world[cell.Y][cell.X] = 255
+	}
+	return world
+}
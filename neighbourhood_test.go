@@ -0,0 +1,39 @@
+package main
+
+import (
+	"testing"
+
+	"uk.ac.bris.cs/gameoflife/kernel"
+	"uk.ac.bris.cs/gameoflife/util"
+)
+
+// TestNeighbourhoods tests von Neumann and hexagonal neighbourhoods, and a Larger than Life von Neumann diamond (see checkRules).
+// the slices start on odd rows as well as even ones, so the hexagonal grid's rows have to be lined up the same way in every halo
+func TestNeighbourhoods(t *testing.T) {
+	checkRules(t, []ruleTest{
+		{name: "vonneumann", check: "check/neighbourhoods/vonneumann", rule: "B13/S024V"},
+		{name: "hex", check: "check/neighbourhoods/hex", rule: "B2/S34", neighbourhood: "hex"},
+		{name: "diamond", check: "check/neighbourhoods/diamond", rule: "R3,C0,M0,S6..14,B8..12,NN", neighbourhood: "vonneumann"},
+	})
+}
+
+// TestParseNeighbourhood checks neighbourhoods are read by name, and that a rule's own neighbourhood can't be overridden with a different one
+func TestParseNeighbourhood(t *testing.T) {
+	for neighbourhood, expected := range map[string]kernel.Neighbourhood{"": kernel.Moore, "moore": kernel.Moore, "vonneumann": kernel.VonNeumann, "hex": kernel.Hex} {
+		parsed, err := kernel.ParseNeighbourhood(neighbourhood)
+		if err != nil || parsed != expected {
+			t.Errorf("ParseNeighbourhood(%q) = %v, %v, expected %v", neighbourhood, parsed, err, expected)
+		}
+	}
+	if _, err := kernel.ParseNeighbourhood("triangle"); err == nil {
+		t.Errorf("ParseNeighbourhood(%q) should have failed", "triangle")
+	}
+
+	for rule, neighbourhood := range map[string]kernel.Neighbourhood{"B2/S34H": kernel.VonNeumann, "R5,C0,M1,S34..58,B34..45,NM": kernel.Hex} {
+		parsed, err := kernel.ParseRule(rule)
+		util.Check(err)
+		if _, err := parsed.WithNeighbourhood(neighbourhood); err == nil {
+			t.Errorf("rule %q with the %v neighbourhood should have failed", rule, neighbourhood)
+		}
+	}
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+
+	"uk.ac.bris.cs/gameoflife/gol"
+)
+
+// TestOutputNames tests the world is written to the output folder under the name template, with each placeholder filled in,
+// and that the name the ImageOutputComplete event gives is the one it was written under
+func TestOutputNames(t *testing.T) {
+	for template, expected := range map[string]string{
+		"":                             `^16x16x100$`,
+		"run-{width}-{height}-t{turn}": `^run-16-16-t100$`,
+		"{rule}/{turn}":                `^B3-S23/100$`,
+		"{timestamp}-{height}x{width}": `^\d{8}-\d{6}-16x16$`,
+	} {
+		t.Run(template, func(t *testing.T) {
+			p := gol.Params{ImageWidth: 16, ImageHeight: 16, Turns: 100, Threads: 1, OutputDir: t.TempDir(), NameTemplate: template}
+			if err := gol.CheckNameTemplate(template); err != nil {
+				t.Fatal(err)
+			}
+
+			events := make(chan gol.Event)
+			go gol.Run(p, events, nil)
+			name := ""
+			for event := range events {
+				if e, ok := event.(gol.ImageOutputComplete); ok {
+					name = e.Filename
+				}
+			}
+			if !regexp.MustCompile(expected).MatchString(name) {
+				t.Fatalf("the world was written out as %q, which doesn't match %v", name, expected)
+			}
+			expectedGreys := readGreys("check/images/16x16x100.pgm", 16, 16)
+			assertEqualGreys(t, readGreys(filepath.Join(p.OutputDir, name+".pgm"), 16, 16), expectedGreys)
+			if _, err := os.Stat(filepath.Join(p.OutputDir, name+".rle")); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+
+	for _, template := range []string{"{turns}", "{height}x{width}x{}", "{Rule}"} {
+		if err := gol.CheckNameTemplate(template); err == nil {
+			t.Errorf("CheckNameTemplate should have failed for %q", template)
+		}
+	}
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"uk.ac.bris.cs/gameoflife/gol"
+	"uk.ac.bris.cs/gameoflife/util"
+)
+
+// TestPatterns tests the Gosper glider gun read from cells and Life 1.06 files, which should land in the same place as the RLE file
+// on 0 and 100 turns, and that the cells and Life 1.06 files written out at the end load back in as the same world
+func TestPatterns(t *testing.T) {
+	for _, test := range []struct {
+		path string
+	}{
+		{path: "images/gosper.cells"},
+		{path: "images/gosper.lif"},
+	} {
+		for _, turns := range []int{0, 100} {
+			p := gol.Params{ImageWidth: 64, ImageHeight: 64, Turns: turns, Threads: 1, InputPath: test.path}
+			t.Run(fmt.Sprintf("%v/64x64x%d", filepath.Base(test.path), turns), func(t *testing.T) {
+				checkOutput(t, p, fmt.Sprintf("check/rle/64x64x%v.pgm", turns))
+			})
+		}
+	}
+
+	for _, test := range []struct {
+		format string
+	}{
+		{format: "cells"},
+		{format: "lif"},
+	} {
+		t.Run(test.format+"/written", func(t *testing.T) {
+			written := writeOut(t, gol.Params{ImageWidth: 64, ImageHeight: 64, Turns: 100, Threads: 1, OutputFormats: []string{test.format}}, test.format)
+			if _, err := os.Stat("out/64x64x100.pgm"); err == nil {
+				t.Errorf("a pgm image was written, but only %v was asked for", test.format)
+			}
+			checkOutput(t, gol.Params{ImageWidth: 64, ImageHeight: 64, Turns: 0, Threads: 1, InputPath: written}, "check/images/64x64x100.pgm")
+		})
+	}
+}
+
+// TestReadPatterns checks cells and Life 1.06 files that can't be loaded give an error
+func TestReadPatterns(t *testing.T) {
+	dir := t.TempDir()
+	for name, broken := range map[string]string{
+		"broken.cells": "!a blinker\nOOX\n",
+		"big.cells":    "!too wide\n" + strings.Repeat("O", 40) + "\n",
+		"broken.lif":   "#Life 1.06\n0 0\n1 a\n",
+		"old.lif":      "#Life 1.05\n#P 0 0\n***\n",
+		"far.lif":      "#Life 1.06\n0 0\n20 0\n",
+	} {
+		path := filepath.Join(dir, name)
+		util.Check(os.WriteFile(path, []byte(broken), 0644))
+		if _, err := gol.WithInput(gol.Params{ImageWidth: 16, ImageHeight: 16, InputPath: path}); err == nil {
+			t.Errorf("WithInput should have failed for %v", name)
+		}
+	}
+}
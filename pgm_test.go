@@ -2,9 +2,12 @@ package main
 
 import (
 	"fmt"
+	"os"
+	"path/filepath"
 	"testing"
 
 	"uk.ac.bris.cs/gameoflife/gol"
+	"uk.ac.bris.cs/gameoflife/util"
 )
 
 // Pgm tests 16x16, 64x64 and 512x512 image output files on 0, 1 and 100 turns using 1-16 worker threads.
@@ -44,3 +47,85 @@ func TestPgm(t *testing.T) {
 		}
 	}
 }
+
+// TestPgmFormats tests 16x16 and 64x64 images on 100 turns, loaded from pgm files written in the other ways the format allows:
+// with comments in the header, as plain (P2) text, with a two byte maxval, with a maxval of 1,
+// and with grey levels that are whitespace bytes or only nearly white, which are read as dead and alive
+func TestPgmFormats(t *testing.T) {
+	dir := t.TempDir()
+	for _, size := range []int{16, 64} {
+		world := readWorld(fmt.Sprintf("images/%vx%v.pgm", size, size), size, size)
+		raw := func(header string, grey func(alive bool) []byte) []byte {
+			data := []byte(header)
+			for _, row := range world {
+				for _, cell := range row {
+					data = append(data, grey(cell == 255)...)
+				}
+			}
+			return data
+		}
+		plain := []byte(fmt.Sprintf("P2\n# a plain pgm\n%d %d\n255\n", size, size))
+		for _, row := range world {
+			for x, cell := range row {
+				plain = append(plain, fmt.Sprintf("%d", cell)...)
+				if x%10 == 9 {
+					plain = append(plain, "\n"...)
+				} else {
+					plain = append(plain, "  "...)
+				}
+			}
+		}
+
+		files := map[string][]byte{
+			"comments": raw(fmt.Sprintf("P5 # raw\n# made by hand\n%d\n# height next\n%d 255\n", size, size), func(alive bool) []byte {
+				if alive {
+					return []byte{255}
+				}
+				return []byte{0}
+			}),
+			"plain": plain,
+			"sixteen": raw(fmt.Sprintf("P5\n%d %d\n65535\n", size, size), func(alive bool) []byte {
+				if alive {
+					return []byte{255, 255}
+				}
+				return []byte{0, 0}
+			}),
+			"bits": raw(fmt.Sprintf("P5\n%d %d\n1\n", size, size), func(alive bool) []byte {
+				if alive {
+					return []byte{1}
+				}
+				return []byte{0}
+			}),
+			"thresholds": raw(fmt.Sprintf("P5\n%d %d\n255\n", size, size), func(alive bool) []byte {
+				if alive {
+					return []byte{200}
+				}
+				return []byte{'\n'}
+			}),
+		}
+		expectedAlive := readAliveCells(fmt.Sprintf("check/images/%vx%vx100.pgm", size, size), size, size)
+		for name, data := range files {
+			path := filepath.Join(dir, fmt.Sprintf("%v%v.pgm", name, size))
+			util.Check(os.WriteFile(path, data, 0644))
+			p := gol.Params{Turns: 100, Threads: 1, InputPath: path}
+			t.Run(fmt.Sprintf("%v/%dx%dx100", name, size, size), func(t *testing.T) {
+				assertEqualBoard(t, runToEnd(t, p).Alive, expectedAlive, gol.Params{ImageWidth: size, ImageHeight: size, Turns: 100})
+			})
+		}
+	}
+
+	for name, broken := range map[string]string{
+		"past maxval":  "P5\n2 2\n1\n\x00\x01\x02\x00",
+		"short":        "P5\n2 2\n255\n\x00\x01\x02",
+		"short plain":  "P2\n2 2\n255\n0 255 0",
+		"not a number": "P2\n2 2\n255\n0 255 0 x",
+		"no maxval":    "P5\n2 2\n",
+		"big maxval":   "P5\n2 2\n65536\n",
+	} {
+		path := filepath.Join(dir, "broken.pgm")
+		util.Check(os.WriteFile(path, []byte(broken), 0644))
+		if _, err := gol.WithInput(gol.Params{InputPath: path}); err == nil {
+			t.Errorf("WithInput should have failed for a pgm file that is %v", name)
+		}
+	}
+}
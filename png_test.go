@@ -0,0 +1,75 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"uk.ac.bris.cs/gameoflife/gol"
+	"uk.ac.bris.cs/gameoflife/util"
+)
+
+// TestPng tests a 64x64 world read from a colour PNG image, with alive cells yellow and dead ones dark blue, and written out as
+// PNG images on 100 turns, once a pixel to a cell and once scaled up to 3 pixels to a cell
+func TestPng(t *testing.T) {
+	start := readGreys("check/images/64x64x0.pgm", 64, 64)
+	img := image.NewRGBA(image.Rect(0, 0, 64, 64))
+	for y, row := range start {
+		for x, grey := range row {
+			if grey == 255 {
+				img.Set(x, y, color.RGBA{R: 255, G: 220, A: 255})
+			} else {
+				img.Set(x, y, color.RGBA{B: 128, A: 255})
+			}
+		}
+	}
+	input := filepath.Join(t.TempDir(), "colour.png")
+	file, err := os.Create(input)
+	util.Check(err)
+	util.Check(png.Encode(file, img))
+	util.Check(file.Close())
+
+	expected := readGreys("check/images/64x64x100.pgm", 64, 64)
+	for _, test := range []struct {
+		scale int
+	}{
+		{scale: 1},
+		{scale: 3},
+	} {
+		scale := test.scale
+		t.Run(fmt.Sprintf("colour.png/scale%d", scale), func(t *testing.T) {
+			p, err := gol.WithInput(gol.Params{Turns: 100, Threads: 4, InputPath: input, OutputFormats: []string{"pgm", "png"}, Scale: scale})
+			util.Check(err)
+			if p.ImageWidth != 64 || p.ImageHeight != 64 {
+				t.Fatalf("WithInput read %v as %dx%d, rather than 64x64", input, p.ImageWidth, p.ImageHeight)
+			}
+			checkOutput(t, p, "check/images/64x64x100.pgm")
+
+			file, err := os.Open("out/64x64x100.png")
+			util.Check(err)
+			defer file.Close()
+			written, err := png.Decode(file)
+			util.Check(err)
+			if written.Bounds().Dx() != 64*scale || written.Bounds().Dy() != 64*scale {
+				t.Fatalf("out/64x64x100.png is %dx%d, rather than %dx%d", written.Bounds().Dx(), written.Bounds().Dy(), 64*scale, 64*scale)
+			}
+			for y := 0; y < 64*scale; y++ {
+				for x := 0; x < 64*scale; x++ {
+					if grey := color.GrayModel.Convert(written.At(x, y)).(color.Gray).Y; grey != expected[y/scale][x/scale] {
+						t.Fatalf("pixel (%d, %d) of out/64x64x100.png is %d, rather than %d", x, y, grey, expected[y/scale][x/scale])
+					}
+				}
+			}
+		})
+	}
+
+	broken := filepath.Join(t.TempDir(), "broken.png")
+	util.Check(os.WriteFile(broken, []byte("\x89PNG\r\n\x1a\nnot really"), 0644))
+	if _, err := gol.WithInput(gol.Params{InputPath: broken}); err == nil {
+		t.Errorf("WithInput should have failed for %v", broken)
+	}
+}
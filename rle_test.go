@@ -0,0 +1,74 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"uk.ac.bris.cs/gameoflife/gol"
+	"uk.ac.bris.cs/gameoflife/util"
+)
+
+// TestRle tests the Gosper glider gun read from an RLE file and placed in the middle of a 64x64 world on 0, 1 and 100 turns,
+// and that the RLE files written out at the end load back in as the same world, for Conway's Life and for Wireworld,
+// whose rule is only given by the RLE file's header
+func TestRle(t *testing.T) {
+	for _, turns := range []int{0, 1, 100} {
+		p := gol.Params{ImageWidth: 64, ImageHeight: 64, Turns: turns, Threads: 1, InputPath: "images/gosper.rle"}
+		t.Run(fmt.Sprintf("gosper/64x64x%d", turns), func(t *testing.T) {
+			checkOutput(t, p, fmt.Sprintf("check/rle/64x64x%v.pgm", turns))
+		})
+	}
+
+	for _, test := range []struct {
+		name     string
+		p        gol.Params
+		expected string
+	}{
+		{"life", gol.Params{ImageWidth: 64, ImageHeight: 64, Turns: 100}, "check/images/64x64x100.pgm"},
+		{"wireworld", gol.Params{Turns: 100, Rule: "Wireworld", InputPath: "check/rules/wireworld/64x64x0.pgm"}, "check/rules/wireworld/64x64x100.pgm"},
+	} {
+		t.Run(test.name+"/written", func(t *testing.T) {
+			written := writeOut(t, test.p, "rle")
+			checkOutput(t, gol.Params{ImageWidth: 64, ImageHeight: 64, Turns: 0, Threads: 1, InputPath: written}, test.expected)
+		})
+	}
+}
+
+// TestRleHeader checks the rule in an RLE file's header is read in the notations Golly and LifeWiki use, and is only used when no rule is given,
+// and that patterns that can't be loaded give an error
+func TestRleHeader(t *testing.T) {
+	dir := t.TempDir()
+	for header, expected := range map[string]string{
+		"x = 3, y = 1":                             "",
+		"x = 3, y = 1, rule = B36/S23":             "B36/S23",
+		"x = 3, y = 1, rule = 23/3":                "B3/S23",
+		"x = 3, y = 1, rule = B3/S23:T64,64":       "B3/S23",
+		"x=3,y=1,rule=R5,C0,M1,S34..58,B34..45,NM": "R5,C0,M1,S34..58,B34..45,NM",
+		"x = 3, y = 1, rule = Wireworld":           "Wireworld",
+	} {
+		path := filepath.Join(dir, "header.rle")
+		util.Check(os.WriteFile(path, []byte("#C a blinker\n"+header+"\n3o!\n"), 0644))
+		p, err := gol.WithInput(gol.Params{ImageWidth: 16, ImageHeight: 16, InputPath: path})
+		if err != nil || p.Rule != expected {
+			t.Errorf("the rule of %q was read as %q, %v, expected %q", header, p.Rule, err, expected)
+		}
+		if p, _ := gol.WithInput(gol.Params{ImageWidth: 16, ImageHeight: 16, InputPath: path, Rule: "B2/S"}); p.Rule != "B2/S" {
+			t.Errorf("the rule of %q was used instead of the one given", header)
+		}
+	}
+
+	for name, broken := range map[string]string{
+		"no header":  "3o!\n",
+		"too big":    "x = 40, y = 1\n40o!\n",
+		"too long":   "x = 2, y = 1\n3o!\n",
+		"bad states": "x = 3, y = 1\n3z!\n",
+	} {
+		path := filepath.Join(dir, "broken.rle")
+		util.Check(os.WriteFile(path, []byte(broken), 0644))
+		if _, err := gol.WithInput(gol.Params{ImageWidth: 16, ImageHeight: 16, InputPath: path}); err == nil {
+			t.Errorf("WithInput should have failed for a pattern with %v", name)
+		}
+	}
+}
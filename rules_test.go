@@ -0,0 +1,54 @@
+package main
+
+import (
+	"testing"
+
+	"uk.ac.bris.cs/gameoflife/kernel"
+)
+
+// TestRules tests the B/S rules HighLife, Seeds and Day & Night (see checkRules)
+func TestRules(t *testing.T) {
+	checkRules(t, []ruleTest{
+		{name: "highlife", check: "check/rules/highlife", rule: "B36/S23"},
+		{name: "seeds", check: "check/rules/seeds", rule: "B2/S"},
+		{name: "daynight", check: "check/rules/daynight", rule: "B3678/S34678"},
+	})
+}
+
+// TestGenerations tests the Generations rules Brian's Brain and Star Wars, whose dying cells are grey levels in the check images (see checkRules).
+// only the cells in state 1 are counted as alive
+func TestGenerations(t *testing.T) {
+	checkRules(t, []ruleTest{
+		{name: "briansbrain", check: "check/rules/briansbrain", rule: "B2/S/C3"},
+		{name: "starwars", check: "check/rules/starwars", rule: "B2/S345/C4"},
+	})
+}
+
+// TestLargerThanLife tests the Larger than Life rules Bosco's rule, Waffle and Globe (see checkRules), whose halos have to be several radii deep
+func TestLargerThanLife(t *testing.T) {
+	checkRules(t, []ruleTest{
+		{name: "bosco", check: "check/rules/bosco", rule: "R5,C0,M1,S34..58,B34..45,NM"},
+		{name: "waffle", check: "check/rules/waffle", rule: "R7,C0,M1,S100..200,B75..170,NM"},
+		{name: "globe", check: "check/rules/globe", rule: "R8,C0,M0,S163..223,B74..252,NM"},
+	})
+}
+
+// TestParseRule checks rules are read in B/S notation and written back out the same way
+func TestParseRule(t *testing.T) {
+	for rule, expected := range map[string]string{"": "B3/S23", "B3/S23": "B3/S23", "b36/s23": "B36/S23", "B2/S": "B2/S", "B/S012345678": "B/S012345678", "B2/S/C3": "B2/S/C3", "b2/s345/c4": "B2/S345/C4", "B3/S23/C2": "B3/S23",
+		"R5,C0,M1,S34..58,B34..45,NM": "R5,C0,M1,S34..58,B34..45,NM", "r7,c0,m1,s100..200,b75..170,nm": "R7,C0,M1,S100..200,B75..170,NM",
+		"R3,C4,M0,S2..5,B3,NM": "R3,C4,M0,S2..5,B3..3,NM", "R1,C0,M0,S2..3,B3,NM": "B3/S23", "R1,C0,M1,S3..4,B3..3,NM": "B3/S23",
+		"B2/S34H": "B2/S34H", "b13/s024v": "B13/S024V", "b2/sh/c3": "B2/SH/C3", "R3,C0,M0,S6..14,B8..12,NN": "R3,C0,M0,S6..14,B8..12,NN", "R1,C0,M0,S1,B1,NN": "B1/S1V",
+		"Wireworld": "Wireworld", "BriansBrain": "BriansBrain"} {
+		parsed, err := kernel.ParseRule(rule)
+		if err != nil || parsed.String() != expected {
+			t.Errorf("ParseRule(%q) = %v, %v, expected %v", rule, parsed, err, expected)
+		}
+	}
+	for _, rule := range []string{"23/3", "B9/S23", "B3S23", "Life", "B2/S/C1", "B2/S/3", "B2/S/C3/C4",
+		"R5,C0,M1,S34..58,NM", "R0,C0,M1,S1,B1,NM", "R5,C0,M2,S34..58,B34..45,NM", "R5,C0,M1,S58..34,B34..45,NM", "R5,C0,M1,S34..58,B34..45,NH", "R5,R6,S1,B1", "wire world"} {
+		if _, err := kernel.ParseRule(rule); err == nil {
+			t.Errorf("ParseRule(%q) should have failed", rule)
+		}
+	}
+}
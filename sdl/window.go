@@ -14,6 +14,7 @@ type Window struct {
 	renderer      *sdl.Renderer
 	texture       *sdl.Texture
 	pixels        []byte
+	hex           bool
 }
 
 func filterEvent(e sdl.Event, userdata interface{}) bool {
@@ -41,9 +42,18 @@ func NewWindow(width, height int32) *Window {
 		renderer,
 		texture,
 		make([]byte, width*height*4),
+		false,
 	}
 }
 
+// NewHexWindow opens a window for a hexagonal grid of width by height cells. each cell is drawn two pixels wide,
+// and odd rows are shifted one pixel (half a cell) to the east
+func NewHexWindow(width, height int32) *Window {
+	w := NewWindow(2*width+1, height)
+	w.hex = true
+	return w
+}
+
 func (w *Window) Destroy() {
 	err := w.texture.Destroy()
 	util.Check(err)
@@ -77,10 +87,24 @@ func (w *Window) SetPixel(x, y int) {
 }
 
 func (w *Window) FlipPixel(x, y int) {
-	if x < 0 || y < 0 || x >= int(w.Width) || y >= int(w.Height) {
+	cellsWide := int(w.Width)
+	if w.hex {
+		cellsWide = (cellsWide - 1) / 2
+	}
+	if x < 0 || y < 0 || x >= cellsWide || y >= int(w.Height) {
 		panic(fmt.Sprintf("CellFlipped event at (%d, %d) is outside the bounds of the window.", x, y))
 	}
 
+	if w.hex {
+		//a hex cell is two pixels, shifted along by one on odd rows
+		w.flipPixel(2*x+y%2, y)
+		w.flipPixel(2*x+y%2+1, y)
+		return
+	}
+	w.flipPixel(x, y)
+}
+
+func (w *Window) flipPixel(x, y int) {
 	width := int(w.Width)
 	w.pixels[4*(y*width+x)+0] = ^w.pixels[4*(y*width+x)+0]
 	w.pixels[4*(y*width+x)+1] = ^w.pixels[4*(y*width+x)+1]
@@ -95,6 +119,10 @@ func (w *Window) CountPixels() int {
 			count++
 		}
 	}
+	//each hex cell is two pixels
+	if w.hex {
+		count /= 2
+	}
 	return count
 }
 
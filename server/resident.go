@@ -0,0 +1,245 @@
+package main
+
+import (
+	"errors"
+	"net/rpc"
+	"sync"
+	"time"
+
+	"uk.ac.bris.cs/gameoflife/kernel"
+	"uk.ac.bris.cs/gameoflife/stubs"
+	"uk.ac.bris.cs/gameoflife/util"
+)
+
+// resident is the slice a server keeps between turns when it is part of the broker's peer-to-peer engine
+type resident struct {
+	session    int
+	rows       util.BitBoard
+	rule       kernel.Rule
+	boundary   util.Boundary
+	turn       int
+	above      string
+	below      string
+	top        bool
+	bottom     bool
+	aboveHalos map[int][][]uint64
+	belowHalos map[int][][]uint64
+}
+
+// residentMutex guards slice. residentChanged is broadcast whenever a halo row arrives or a new slice is loaded
+var residentMutex sync.Mutex
+var residentChanged = sync.NewCond(&residentMutex)
+var slice resident
+
+// neighbours holds the connections to the servers either side of this one
+var neighboursMutex sync.Mutex
+var neighbours = make(map[string]*rpc.Client)
+
+// LoadSlice replaces the slice this server holds. any Advance still running for an earlier session gives up
+func (g *GolOperations) LoadSlice(req stubs.LoadSliceRequest, res *stubs.SessionResponse) (err error) {
+	rule, err := kernel.ParseRule(req.Rule)
+	if err != nil {
+		return
+	}
+	boundary, err := util.ParseBoundary(req.Boundary)
+	if err != nil {
+		return
+	}
+
+	residentMutex.Lock()
+	slice = resident{
+		session:    req.Session,
+		rows:       req.Rows,
+		rule:       rule,
+		boundary:   boundary,
+		turn:       req.Turn,
+		above:      req.Above,
+		below:      req.Below,
+		top:        req.Top,
+		bottom:     req.Bottom,
+		aboveHalos: make(map[int][][]uint64),
+		belowHalos: make(map[int][][]uint64),
+	}
+	residentChanged.Broadcast()
+	residentMutex.Unlock()
+
+	res.Turn = req.Turn
+
+	return
+}
+
+// ReceiveHalo stores halo rows from a neighbour until the turn they are for is processed
+func (g *GolOperations) ReceiveHalo(req stubs.HaloRow, res *stubs.SessionResponse) (err error) {
+	residentMutex.Lock()
+	defer residentMutex.Unlock()
+
+	//rows left over from an earlier load of the world are ignored
+	if req.Session != slice.session {
+		return
+	}
+	if req.Above {
+		slice.aboveHalos[req.Turn] = req.Rows
+	} else {
+		slice.belowHalos[req.Turn] = req.Rows
+	}
+	residentChanged.Broadcast()
+	res.Turn = slice.turn
+
+	return
+}
+
+// Advance processes a number of turns of the resident slice. at the start of every turn, the top rows are sent to the server above
+// and the bottom rows to the server below, as many as the rule's radius, then this server waits for their edge rows to use as its halo.
+// on the top and bottom edges of the world, the boundary may mean there is no server across the edge to swap rows with
+func (g *GolOperations) Advance(req stubs.AdvanceRequest, res *stubs.AdvanceResponse) (err error) {
+	residentMutex.Lock()
+	defer residentMutex.Unlock()
+
+	if req.Session != slice.session {
+		return errors.New("slice has been reloaded")
+	}
+
+	for t := 0; t < req.Turns; t++ {
+		current := slice
+		radius := current.rule.Radius
+		first, last := current.rows.Rows[:radius], current.rows.Rows[current.rows.Height-radius:]
+		swapAbove, swapBelow := current.swapsAcross(current.top), current.swapsAcross(current.bottom)
+		residentMutex.Unlock()
+		if swapAbove {
+			err = sendHalo(current.above, stubs.HaloRow{Session: current.session, Turn: current.turn, Rows: first, Above: false})
+		}
+		if err == nil && swapBelow {
+			err = sendHalo(current.below, stubs.HaloRow{Session: current.session, Turn: current.turn, Rows: last, Above: true})
+		}
+		residentMutex.Lock()
+		if err != nil {
+			return
+		}
+
+		above, below, err := awaitHalos(current.session, current.turn, req.Timeout, swapAbove, swapBelow)
+		if err != nil {
+			return err
+		}
+		above = current.edgeHalo(current.top, above, first)
+		below = current.edgeHalo(current.bottom, below, last)
+
+		//the slice is updated with halo rows either side of it, so nothing wraps vertically
+		rows := make([][]uint64, 0, current.rows.Height+2*radius)
+		rows = append(rows, above...)
+		rows = append(rows, current.rows.Rows...)
+		rows = append(rows, below...)
+		residentMutex.Unlock()
+		newRows := calculateRows(current.rows.WithRowsFrom(-radius, rows), radius, len(rows)-radius, current.rule, current.boundary)
+		residentMutex.Lock()
+
+		if slice.session != current.session {
+			return errors.New("slice has been reloaded")
+		}
+		slice.rows = newRows
+		slice.turn++
+	}
+
+	res.Turn = slice.turn
+	res.NumAliveCells = slice.rows.Count()
+
+	return
+}
+
+// swapsAcross reports whether a slice swaps rows with the server across one of its ends. across the top or bottom edge of the world (edge is true),
+// that is only the case when the world wraps around
+func (r resident) swapsAcross(edge bool) bool {
+	return !edge || r.boundary == util.Torus || r.boundary == util.Klein
+}
+
+// edgeHalo is the halo rows for one end of a slice, given the rows received from the server across it and the slice's own rows at that end
+func (r resident) edgeHalo(edge bool, received, own [][]uint64) [][]uint64 {
+	if !edge {
+		return received
+	}
+	halo := make([][]uint64, len(own))
+	switch r.boundary {
+	case util.Dead:
+		//rows past a dead edge are left empty
+	case util.Mirror:
+		for i, row := range own {
+			halo[len(own)-1-i] = row
+		}
+	case util.Klein:
+		for i, row := range received {
+			halo[i] = util.FlipRow(row, r.rows.Width)
+		}
+	default:
+		halo = received
+	}
+	return halo
+}
+
+// awaitHalos waits for the halo rows of a turn that are coming from the servers above and below to arrive. it must be called with residentMutex held
+func awaitHalos(session, turn int, timeout time.Duration, fromAbove, fromBelow bool) ([][]uint64, [][]uint64, error) {
+	//wakes this goroutine up when the timeout runs out, in case no rows arrive
+	expired := false
+	timer := time.AfterFunc(timeout, func() {
+		residentMutex.Lock()
+		expired = true
+		residentChanged.Broadcast()
+		residentMutex.Unlock()
+	})
+	defer timer.Stop()
+
+	for {
+		if slice.session != session {
+			return nil, nil, errors.New("slice has been reloaded")
+		}
+		above, gotAbove := slice.aboveHalos[turn]
+		below, gotBelow := slice.belowHalos[turn]
+		if (gotAbove || !fromAbove) && (gotBelow || !fromBelow) {
+			delete(slice.aboveHalos, turn)
+			delete(slice.belowHalos, turn)
+			return above, below, nil
+		}
+		if expired {
+			return nil, nil, errors.New("timed out waiting for a halo row from a neighbour")
+		}
+		residentChanged.Wait()
+	}
+}
+
+// CollectSlice hands the resident slice back to the broker
+func (g *GolOperations) CollectSlice(req stubs.SessionRequest, res *stubs.ServerResponse) (err error) {
+	residentMutex.Lock()
+	defer residentMutex.Unlock()
+
+	if req.Session != slice.session {
+		return errors.New("slice has been reloaded")
+	}
+	res.World = slice.rows
+
+	return
+}
+
+// sendHalo passes a halo row to a neighbour, dialling it the first time. a broken connection is forgotten so the next load can redial
+func sendHalo(address string, row stubs.HaloRow) error {
+	neighboursMutex.Lock()
+	neighbour, ok := neighbours[address]
+	if !ok {
+		var err error
+		neighbour, err = rpc.Dial("tcp", address)
+		if err != nil {
+			neighboursMutex.Unlock()
+			return err
+		}
+		neighbours[address] = neighbour
+	}
+	neighboursMutex.Unlock()
+
+	err := neighbour.Call(stubs.ReceiveHalo, row, new(stubs.SessionResponse))
+	if err != nil {
+		if _, alive := err.(rpc.ServerError); !alive {
+			neighboursMutex.Lock()
+			delete(neighbours, address)
+			neighboursMutex.Unlock()
+			neighbour.Close()
+		}
+	}
+	return err
+}
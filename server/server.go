@@ -2,105 +2,108 @@ package main
 
 import (
 	"flag"
+	"log"
 	"net"
 	"net/rpc"
+	"os"
+	"os/signal"
+	"syscall"
 	"time"
+	"uk.ac.bris.cs/gameoflife/kernel"
 	"uk.ac.bris.cs/gameoflife/stubs"
+	"uk.ac.bris.cs/gameoflife/util"
 )
 
 var killServer = false
 var numberOfThreads int
 
+// the kernel each thread uses to update its rows, chosen with the -kernel flag
+var updateCells = kernel.UpdateCells
+
 type GolOperations struct{}
 
 // code used directly from CSA Lab 1
 func (g *GolOperations) CalculateNextState(req *stubs.ServerRequest, res *stubs.ServerResponse) (err error) {
 
-	ImageWidth := req.ImageWidth
 	ImageHeight := req.ImageHeight
 	world := req.World
+	rule, err := kernel.ParseRule(req.Rule)
+	if err != nil {
+		return
+	}
+	boundary, err := util.ParseBoundary(req.Boundary)
+	if err != nil {
+		return
+	}
 
 	serverNumber := req.ServerNumber
 	numberOfServers := req.NoOfServers
 	//what rows of cells should this specific server update? startIndex is inclusive but endIndex is exclusive
-	startIndex := (serverNumber) * (ImageHeight / numberOfServers)
-	endIndex := (serverNumber + 1) * (ImageHeight / numberOfServers)
-
-	//if the number of servers doesn't evenly divide, give the last server the rest
-	//the max number of AWS nodes will be 4
-	//3 is the only number that doesn't evenly divide into 16, 64, and 512
-	//in this case, the last server will only be given an additional 1, 1 and 2 rows respectively
-	if serverNumber == numberOfServers-1 {
-		endIndex = ImageHeight
+	startIndex, endIndex := stubs.SliceBounds(ImageHeight, numberOfServers, serverNumber)
+
+	res.World = calculateRows(world, startIndex, endIndex, rule, boundary)
+
+	return
+}
+
+// CalculateNextSlice is the halo exchange version of CalculateNextState. the request only holds this server's slice
+// with Turns halo rows above and below it for each row of the rule's radius. each turn updates all but radius rows at each end,
+// so nothing wraps vertically and the rows shrink until only the slice is left
+func (g *GolOperations) CalculateNextSlice(req *stubs.SliceRequest, res *stubs.ServerResponse) (err error) {
+	rule, err := kernel.ParseRule(req.Rule)
+	if err != nil {
+		return
+	}
+	boundary, err := util.ParseBoundary(req.Boundary)
+	if err != nil {
+		return
 	}
+	rows := req.Rows
+	turns := req.Turns
+	if turns < 1 {
+		turns = 1
+	}
+	for t := 0; t < turns; t++ {
+		rows = calculateRows(rows, rule.Radius, rows.Height-rule.Radius, rule, boundary)
+	}
+	res.World = rows
+
+	return
+}
 
+// calculateRows splits rows startIndex (inclusive) to endIndex (exclusive) of the world between the threads and returns their next state under the rule and boundary
+func calculateRows(world util.BitBoard, startIndex, endIndex int, rule kernel.Rule, boundary util.Boundary) util.BitBoard {
 	//calculates how many rows should be allocated to each thread
 	totalRows := endIndex - startIndex
 	rowsPerThread := totalRows / numberOfThreads
 
 	//makes a slice to hold the channels of each thread
-	threadSlice := make([]chan [][]byte, numberOfThreads)
+	threadSlice := make([]chan [][]uint64, numberOfThreads)
 
 	//initialise channel in each index of the slice
 	for i, _ := range threadSlice {
-		threadSlice[i] = make(chan [][]byte)
+		threadSlice[i] = make(chan [][]uint64)
 	}
 
 	//non-blocking call to UpdateCells for each thread, which will send the processed rows down the channel
 	for i, _ := range threadSlice {
 		//the final thread will pick up the remaining rows if the number of threads doesn't divide the number of rows evenly
 		if i == len(threadSlice)-1 {
-			go UpdateCells(world, startIndex+(i*rowsPerThread), endIndex, ImageHeight, ImageWidth, threadSlice[i])
+			go updateCells(world, startIndex+(i*rowsPerThread), endIndex, rule, boundary, threadSlice[i])
 		} else {
-			go UpdateCells(world, startIndex+(i*rowsPerThread), startIndex+((i+1)*rowsPerThread), ImageHeight, ImageWidth, threadSlice[i])
+			go updateCells(world, startIndex+(i*rowsPerThread), startIndex+((i+1)*rowsPerThread), rule, boundary, threadSlice[i])
 		}
 	}
 
 	//makes a new world to concatenate all the rows in order
-	newWorld := make([][]byte, 0)
+	newRows := make([][]uint64, 0, totalRows)
 
 	//concatenates all the newly processed rows in order
 	for i, _ := range threadSlice {
-		newWorld = append(newWorld, <-threadSlice[i]...)
+		newRows = append(newRows, <-threadSlice[i]...)
 	}
 
-	res.World = newWorld
-
-	return
-}
-
-func UpdateCells(world [][]byte, startIndex, endIndex, ImageHeight, ImageWidth int, rowsChan chan [][]byte) {
-
-	workerWorld := make([][]byte, endIndex-startIndex)
-	for i := range workerWorld {
-		workerWorld[i] = make([]byte, ImageWidth)
-		copy(workerWorld[i], world[i+startIndex])
-	}
-
-	for i := startIndex; i < endIndex; i++ {
-		for j := 0; j < ImageWidth; j++ {
-			iBehind := (i - 1 + ImageHeight) % ImageHeight
-			iAhead := (i + 1 + ImageHeight) % ImageHeight
-			jBehind := (j - 1 + ImageWidth) % ImageWidth
-			jAhead := (j + 1 + ImageWidth) % ImageWidth
-
-			neighbourSum := int(world[iBehind][jBehind]) + int(world[iBehind][j]) + int(world[iBehind][jAhead]) + int(world[i][jBehind]) + int(world[i][jAhead]) + int(world[iAhead][jBehind]) + int(world[iAhead][j]) + int(world[iAhead][jAhead])
-			liveNeighbours := neighbourSum / 255
-
-			if world[i][j] == 255 {
-				if (liveNeighbours < 2) || (liveNeighbours > 3) {
-					//i-startIndex because the startIndex may be something like 8, but newWorld starts at index 0
-					workerWorld[i-startIndex][j] = 0
-				}
-			} else if world[i][j] == 0 {
-				if liveNeighbours == 3 {
-					workerWorld[i-startIndex][j] = 255
-				}
-			}
-		}
-	}
-	rowsChan <- workerWorld
-	return
+	return world.WithRowsFrom(startIndex, newRows)
 }
 
 // kills the server
@@ -113,15 +116,52 @@ func (g *GolOperations) KillServer(req stubs.Request, res *stubs.Response) (err
 func main() {
 	pAddr := flag.String("port", "8031", "Port to listen on")
 	pThreads := flag.Int("threads", 1, "Number of threads to use")
+	pBroker := flag.String("broker", "", "Address of a broker to register with, e.g. 127.0.0.1:8030")
+	pIP := flag.String("ip", "127.0.0.1", "IP address the broker should use to reach this server")
+	pKernel := flag.String("kernel", "cell", "Kernel to update the world with: cell (one cell at a time) or bitsliced (64 cells at a time)")
+	flag.StringVar(&kernel.TableDir, "rules", "rules", "Folder to load rule tables from, as <name>.rule")
 	flag.Parse()
 	numberOfThreads = *pThreads
+	switch *pKernel {
+	case "cell":
+		updateCells = kernel.UpdateCells
+	case "bitsliced":
+		updateCells = kernel.UpdateCellsBitSliced
+	default:
+		log.Fatal("unknown kernel ", *pKernel)
+	}
 	//registers the golOperations with rpc, to allow the client to call these functions
 	rpc.Register(&GolOperations{})
-	listener, _ := net.Listen("tcp", ":"+*pAddr)
+	listener, err := net.Listen("tcp", ":"+*pAddr)
+	if err != nil {
+		log.Fatal(err)
+	}
 	defer listener.Close()
+
+	//announces this server to the broker, so it is given a share of the rows from the next turn onwards
+	address := *pIP + ":" + *pAddr
+	if *pBroker != "" {
+		err = callBroker(*pBroker, stubs.BrokerRegisterWorker, address)
+		if err != nil {
+			log.Fatal("could not register with the broker: ", err)
+		}
+		defer callBroker(*pBroker, stubs.BrokerDeregisterWorker, address)
+
+		//leaves the pool cleanly if the server is interrupted
+		go func() {
+			sigterm := make(chan os.Signal, 1)
+			signal.Notify(sigterm, syscall.SIGTERM, syscall.SIGINT)
+			<-sigterm
+			callBroker(*pBroker, stubs.BrokerDeregisterWorker, address)
+			os.Exit(0)
+		}()
+	}
+
 	//checks if the server is supposed to be killed
 	go func() {
 		for {
+			//polls rather than spins, so this goroutine doesn't hog a core the workers need
+			time.Sleep(100 * time.Millisecond)
 			if killServer {
 				time.Sleep(1 * time.Second)
 				listener.Close()
@@ -131,3 +171,14 @@ func main() {
 	rpc.Accept(listener)
 
 }
+
+// callBroker sends this server's address to the broker's RegisterWorker or DeregisterWorker
+func callBroker(brokerAddress, method, address string) error {
+	broker, err := rpc.Dial("tcp", brokerAddress)
+	if err != nil {
+		return err
+	}
+	defer broker.Close()
+
+	return broker.Call(method, stubs.WorkerRequest{Address: address}, new(stubs.WorkerResponse))
+}
@@ -1,6 +1,10 @@
 package stubs
 
-import "uk.ac.bris.cs/gameoflife/util"
+import (
+	"time"
+
+	"uk.ac.bris.cs/gameoflife/util"
+)
 
 // Broker executes all the specified turns of GOL
 var Broker = "BrokerOperations.Broker"
@@ -24,39 +28,161 @@ var BrokerCloseAllComponents = "BrokerOperations.CloseAllComponents"
 // Resume processing on the broker and have the client print Continuing
 var BrokerPauseProcessingToggle = "BrokerOperations.PauseProcessingToggle"
 
+// BrokerRegisterWorker is called by a server when it starts up, to join the broker's pool of workers.
+// The broker rebalances the rows of the world across its workers at the next turn boundary
+var BrokerRegisterWorker = "BrokerOperations.RegisterWorker"
+
+// BrokerDeregisterWorker is called by a server when it shuts down, to leave the broker's pool of workers
+var BrokerDeregisterWorker = "BrokerOperations.DeregisterWorker"
+
 // CalculateNextState is called by the broker on all the servers when it wants one turn of GOL processed.
 var CalculateNextState = "GolOperations.CalculateNextState"
 
+// CalculateNextSlice is the halo exchange alternative to CalculateNextState. The broker only sends a server the rows it updates, plus halo rows either side
+var CalculateNextSlice = "GolOperations.CalculateNextSlice"
+
+// LoadSlice is called by the broker's peer-to-peer engine to hand a server the slice it keeps between turns, and tell it who its neighbours are
+var LoadSlice = "GolOperations.LoadSlice"
+
+// Advance is called by the broker's peer-to-peer engine on all the servers when it wants a number of turns processed.
+// The servers swap halo rows with their neighbours through ReceiveHalo every turn, and reply with how many cells are alive in their slice
+var Advance = "GolOperations.Advance"
+
+// ReceiveHalo is called by a server on its neighbours, to pass them the edge rows of its slice at the start of each turn
+var ReceiveHalo = "GolOperations.ReceiveHalo"
+
+// CollectSlice is called by the broker's peer-to-peer engine when it needs a server's slice back, e.g. for the s key or at the end of the run
+var CollectSlice = "GolOperations.CollectSlice"
+
 // KillServer is called by the broker on each of the servers when it wants to terminate them
 var KillServer = "GolOperations.KillServer"
 
-// Request We want to provide the broker with the ImageWidth, ImageHeight, the number of Turns to execute and the initial World
+// Request We want to provide the broker with the ImageWidth, ImageHeight, the number of Turns to execute, the initial World,
+// optionally the Engine to use, optionally how many turns the servers should process per call (TurnsPerBatch), the Rule in B/S notation
+// (empty for B3/S23), the Boundary of the world (empty for torus), the Neighbourhood (empty for the one the rule says, normally Moore),
+// and the StartTurn the World is on, e.g. when resuming from a checkpoint, which CompletedTurns counts on from until it reaches Turns.
+// the Session tells the client's session apart from any other, so the client's q and k keys only stop its own session.
+// worlds are sent bit-packed, one bit per cell
 type Request struct {
-	ImageWidth  int
-	ImageHeight int
-	Turns       int
-	World       [][]byte
+	ImageWidth    int
+	ImageHeight   int
+	Turns         int
+	World         util.BitBoard
+	Engine        string
+	TurnsPerBatch int
+	Rule          string
+	Boundary      string
+	Neighbourhood string
+	StartTurn     int
+	Session       int64
 }
 
 // Response From the broker, the client expects: the number of CompletedTurns, the current state of the World, all the AliveCells, the NumAliveCells and the number of turns executed on termination (TerminateTurns)
 type Response struct {
 	CompletedTurns int
-	World          [][]byte
+	World          util.BitBoard
 	AliveCells     []util.Cell
 	NumAliveCells  int
 	TerminateTurns int
 }
 
-// ServerRequest To process a GOL turn, an individual server needs: the previous World, the ImageWidth and ImageHeight, and the NoOfServers and ServerNumber (to calculate start and end indices)
+// ServerRequest To process a GOL turn, an individual server needs: the previous World, the ImageWidth and ImageHeight, the NoOfServers and ServerNumber (to calculate start and end indices)
+// and the Rule and Boundary to apply
 type ServerRequest struct {
-	World        [][]byte
+	World        util.BitBoard
 	ImageWidth   int
 	ImageHeight  int
 	NoOfServers  int
 	ServerNumber int
+	Rule         string
+	Boundary     string
+}
+
+// SliceRequest To process GOL turns with halo exchange, an individual server only needs the Rows it updates, the number of Turns to process,
+// the Rule and the Boundary. Rows holds Turns halo rows above and below the slice for each row of the rule's radius,
+// as every turn eats that many halo rows from each side
+type SliceRequest struct {
+	Rows     util.BitBoard
+	Turns    int
+	Rule     string
+	Boundary string
+}
+
+// HaloRows picks out rows startIndex-depth to endIndex+depth (exclusive) of the world for a SliceRequest, carrying on past the top and bottom edges
+// the way the boundary says. halo rows past a dead edge are left empty, so the kernel knows they are outside the world and keeps them dead
+func HaloRows(world util.BitBoard, startIndex, endIndex, depth int, boundary util.Boundary) util.BitBoard {
+	rows := make([][]uint64, 0, endIndex-startIndex+2*depth)
+	for i := startIndex - depth; i < endIndex+depth; i++ {
+		rows = append(rows, world.RowAt(i, boundary))
+	}
+	return world.WithRowsFrom(startIndex-depth, rows)
+}
+
+// LoadSliceRequest For the peer-to-peer engine, a server needs the Rows of its slice, the Turn the world is at, the Rule and Boundary to apply,
+// and the addresses of the servers holding the slices Above and Below it. Top and Bottom say whether the slice is on the top or bottom edge
+// of the world, where the boundary decides what its halo rows are. Session identifies this load of the world
+type LoadSliceRequest struct {
+	Session  int
+	Rows     util.BitBoard
+	Turn     int
+	Rule     string
+	Boundary string
+	Above    string
+	Below    string
+	Top      bool
+	Bottom   bool
+}
+
+// AdvanceRequest asks the servers of a Session to process a number of Turns, waiting at most Timeout for each halo row from a neighbour
+type AdvanceRequest struct {
+	Session int
+	Turns   int
+	Timeout time.Duration
+}
+
+// AdvanceResponse From each server, the broker expects the Turn its slice is now at and the NumAliveCells in it
+type AdvanceResponse struct {
+	Turn          int
+	NumAliveCells int
+}
+
+// HaloRow is the edge Rows of a server's slice at the start of a Turn, as many as the rule's radius. Above is true when the rows sit above the receiving server's slice
+type HaloRow struct {
+	Session int
+	Turn    int
+	Rows    [][]uint64
+	Above   bool
+}
+
+// SessionRequest identifies which load of the world a call is about
+type SessionRequest struct {
+	Session int
+}
+
+// SessionResponse is the Turn a server's slice is at
+type SessionResponse struct {
+	Turn int
+}
+
+// WorkerRequest A server registering or deregistering with the broker gives the Address the broker should dial it on
+type WorkerRequest struct {
+	Address string
+}
+
+// WorkerResponse The broker replies with the NoOfServers in its pool after the change
+type WorkerResponse struct {
+	NoOfServers int
+}
+
+// SliceBounds gives the rows [start, end) of the world that server number serverNumber out of noOfServers is responsible for.
+// Rows are shared out as evenly as possible, so any number of servers works, even more servers than there are rows
+func SliceBounds(imageHeight, noOfServers, serverNumber int) (start, end int) {
+	start = serverNumber * imageHeight / noOfServers
+	end = (serverNumber + 1) * imageHeight / noOfServers
+	return
 }
 
 // ServerResponse From the server, the broker expects the rows of the new World that the server processed.
 type ServerResponse struct {
-	World [][]byte
+	World util.BitBoard
 }
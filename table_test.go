@@ -0,0 +1,66 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"uk.ac.bris.cs/gameoflife/gol"
+	"uk.ac.bris.cs/gameoflife/kernel"
+	"uk.ac.bris.cs/gameoflife/util"
+)
+
+// B13/S024V written out as a table, turning the neighbours around the cell rather than listing every order
+const vonNeumannTable = `
+n_states:2
+neighborhood:vonNeumann
+symmetries:rotate4
+var a={0,1}
+var b=a
+var c=a
+var d=a
+0,1,0,0,0,1
+0,1,1,1,0,1
+1,0,0,0,0,1
+1,1,1,0,0,1
+1,1,0,1,0,1
+1,1,1,1,1,1
+1,a,b,c,d,0
+`
+
+// TestRuleTables tests Wireworld, starting from the x0 image of its check images, and Brian's Brain written as a table, which should match
+// the Generations rule (see checkRules)
+func TestRuleTables(t *testing.T) {
+	checkRules(t, []ruleTest{
+		{name: "wireworld", check: "check/rules/wireworld", rule: "Wireworld", start: "check/rules/wireworld/%vx%vx0.pgm"},
+		{name: "briansbrain", check: "check/rules/briansbrain", rule: "BriansBrain"},
+	})
+}
+
+// TestReadTable checks a von Neumann table with rotations runs the same as the B/S rule it is written from, and that broken tables are turned down
+func TestReadTable(t *testing.T) {
+	table, err := kernel.ReadTable("vonneumann", strings.NewReader(vonNeumannTable))
+	util.Check(err)
+	rule := kernel.Rule{States: table.States, Neighbourhood: table.Neighbourhood, Radius: 1, Table: table}
+	for _, size := range []int{16, 64} {
+		start := util.PackWorld(readWorld(fmt.Sprintf("images/%vx%v.pgm", size, size), size, size))
+		expectedAlive := readAliveCells(fmt.Sprintf("check/neighbourhoods/vonneumann/%vx%vx100.pgm", size, size), size, size)
+		for _, world := range advanceKernels(start, rule, util.Torus, 100) {
+			assertEqualBoard(t, world.AliveCells(), expectedAlive, gol.Params{ImageWidth: size, ImageHeight: size, Turns: 100})
+		}
+	}
+
+	for name, broken := range map[string]string{
+		"no states":       "neighborhood:Moore\n0,0,0,0,0,0,0,0,0,1",
+		"too short":       "n_states:2\nneighborhood:Moore\n0,1,1,1,1",
+		"past n_states":   "n_states:2\nneighborhood:vonNeumann\n0,1,2,1,1,1",
+		"unbound output":  "n_states:2\nneighborhood:vonNeumann\nvar a={0,1}\n0,1,1,1,1,a",
+		"bad symmetries":  "n_states:2\nneighborhood:Moore\nsymmetries:rotate3",
+		"no table":        "@RULE Tree\n@TREE\nnum_states=2",
+		"late neighbours": "n_states:2\n0,1,1,1,1,1,1,1,1,1\nneighborhood:vonNeumann",
+	} {
+		if _, err := kernel.ReadTable(name, strings.NewReader(broken)); err == nil {
+			t.Errorf("ReadTable should have failed for a table with %v", name)
+		}
+	}
+}
@@ -0,0 +1,233 @@
+package util
+
+import "math/bits"
+
+// BitBoard is a world packed one bit per cell, 64 cells to a word. the cell at (x, y) is bit x%64 of Rows[y][x/64],
+// and any bits past Width in the last word of a row are always 0.
+//
+// cells with more than two States (for Generations rules, where dying cells pass through states between alive and dead, and rule tables)
+// are held in more than one bit plane, with each row holding WordsPerRow words for each plane one after the other.
+// the first plane is whether each cell is alive (state 1), and the rest hold the state minus one of the other cells in binary.
+// only state 1 counts as alive, so Alive, Count and AliveCells only ever look at the first plane
+//
+// FirstRow is the row of the world that Rows[0] is, for boards that only hold some of the world's rows, such as a slice with its halo.
+// it can be negative when a halo reaches past the top edge. it only matters to neighbourhoods that differ between odd and even rows
+type BitBoard struct {
+	Width    int
+	Height   int
+	States   int
+	FirstRow int
+	Rows     [][]uint64
+}
+
+// WordsPerRow is the number of words needed to hold one plane of a row of width cells
+func WordsPerRow(width int) int {
+	return (width + 63) / 64
+}
+
+// Planes is the number of bit planes needed for cells with the given number of states
+func Planes(states int) int {
+	if states <= 2 {
+		return 1
+	}
+	return 1 + bits.Len(uint(states-2))
+}
+
+// NewBitBoard makes an empty (all dead) board of alive/dead cells
+func NewBitBoard(width, height int) BitBoard {
+	return NewBitBoardWithStates(width, height, 2)
+}
+
+// NewBitBoardWithStates makes an empty (all dead) board of cells with the given number of states
+func NewBitBoardWithStates(width, height, states int) BitBoard {
+	rows := make([][]uint64, height)
+	for i := range rows {
+		rows[i] = make([]uint64, WordsPerRow(width)*Planes(states))
+	}
+	return BitBoard{Width: width, Height: height, States: states, Rows: rows}
+}
+
+// PackWorld converts a world of 0/255 bytes, as read from a PGM image, into a BitBoard
+func PackWorld(world [][]byte) BitBoard {
+	return PackStates(world, 2)
+}
+
+// PackStates converts a world of grey levels, as read from a PGM image, into a BitBoard of cells with the given number of states.
+// each grey level is read as the state whose Grey is closest to it
+func PackStates(world [][]byte, states int) BitBoard {
+	width := 0
+	if len(world) > 0 {
+		width = len(world[0])
+	}
+	board := NewBitBoardWithStates(width, len(world), states)
+	for y, row := range world {
+		for x, grey := range row {
+			if state := StateOf(grey, states); state != 0 {
+				board.SetState(x, y, state)
+			}
+		}
+	}
+	return board
+}
+
+// Unpack converts a BitBoard back into a world of grey levels, ready to be written out as a PGM image
+func (b BitBoard) Unpack() [][]byte {
+	world := make([][]byte, b.Height)
+	for y := range world {
+		world[y] = make([]byte, b.Width)
+		for x := range world[y] {
+			world[y][x] = Grey(b.State(x, y), b.States)
+		}
+	}
+	return world
+}
+
+// Grey is the grey level a state is shown as: 255 for alive, 0 for dead, and evenly spaced levels in between
+// that get darker as a dying cell gets closer to dead
+func Grey(state, states int) byte {
+	switch {
+	case state == 0:
+		return 0
+	case state == 1:
+		return 255
+	default:
+		return byte(255 * (states - state) / (states - 1))
+	}
+}
+
+// StateOf is the state whose Grey is closest to a grey level, so for alive/dead cells, grey levels from 128 up are alive
+func StateOf(grey byte, states int) int {
+	if states <= 2 {
+		if grey >= 128 {
+			return 1
+		}
+		return 0
+	}
+	closest, distance := 0, 256
+	for state := 0; state < states; state++ {
+		d := int(grey) - int(Grey(state, states))
+		if d < 0 {
+			d = -d
+		}
+		if d < distance {
+			closest, distance = state, d
+		}
+	}
+	return closest
+}
+
+// Alive reports whether the cell at (x, y) is alive
+func (b BitBoard) Alive(x, y int) bool {
+	return b.Rows[y][x/64]>>uint(x%64)&1 == 1
+}
+
+// Set makes the cell at (x, y) alive or dead
+func (b BitBoard) Set(x, y int, alive bool) {
+	if alive {
+		b.SetState(x, y, 1)
+	} else {
+		b.SetState(x, y, 0)
+	}
+}
+
+// State is the state of the cell at (x, y): 0 for dead, 1 for alive and 2 upwards for dying
+func (b BitBoard) State(x, y int) int {
+	return RowState(b.Rows[y], x, b.Width, b.States)
+}
+
+// SetState puts the cell at (x, y) into a state
+func (b BitBoard) SetState(x, y, state int) {
+	SetRowState(b.Rows[y], x, b.Width, b.States, state)
+}
+
+// RowState is the state of cell x of a packed row of a board with the given width and number of states
+func RowState(row []uint64, x, width, states int) int {
+	words := WordsPerRow(width)
+	if row[x/64]>>uint(x%64)&1 == 1 {
+		return 1
+	}
+	dying := 0
+	for p := 1; p < Planes(states); p++ {
+		dying |= int(row[p*words+x/64]>>uint(x%64)&1) << uint(p-1)
+	}
+	if dying == 0 {
+		return 0
+	}
+	return dying + 1
+}
+
+// SetRowState puts cell x of a packed row of a board with the given width and number of states into a state
+func SetRowState(row []uint64, x, width, states, state int) {
+	words := WordsPerRow(width)
+	bit := uint64(1) << uint(x%64)
+
+	//the plane values are 1 for alive, and state-1 shifted up a plane for dying
+	planes := 0
+	if state == 1 {
+		planes = 1
+	} else if state > 1 {
+		planes = (state - 1) << 1
+	}
+	for p := 0; p < Planes(states); p++ {
+		if planes>>uint(p)&1 == 1 {
+			row[p*words+x/64] |= bit
+		} else {
+			row[p*words+x/64] &^= bit
+		}
+	}
+}
+
+// Count returns the number of alive cells
+func (b BitBoard) Count() int {
+	words := WordsPerRow(b.Width)
+	count := 0
+	for _, row := range b.Rows {
+		for _, word := range row[:words] {
+			count += bits.OnesCount64(word)
+		}
+	}
+	return count
+}
+
+// AliveCells lists the alive cells, row by row
+func (b BitBoard) AliveCells() []Cell {
+	words := WordsPerRow(b.Width)
+	cells := []Cell{}
+	for y, row := range b.Rows {
+		for w, word := range row[:words] {
+			for word != 0 {
+				bit := bits.TrailingZeros64(word)
+				cells = append(cells, Cell{X: w*64 + bit, Y: y})
+				word &= word - 1
+			}
+		}
+	}
+	return cells
+}
+
+// WithRows returns a board the same width and with the same states as this one, made up of the given rows starting at the same FirstRow
+func (b BitBoard) WithRows(rows [][]uint64) BitBoard {
+	return BitBoard{Width: b.Width, Height: len(rows), States: b.States, FirstRow: b.FirstRow, Rows: rows}
+}
+
+// WithRowsFrom is WithRows for rows that start at row firstRow of this board (which can be past its top edge) rather than at its first row
+func (b BitBoard) WithRowsFrom(firstRow int, rows [][]uint64) BitBoard {
+	board := b.WithRows(rows)
+	board.FirstRow += firstRow
+	return board
+}
+
+// Slice returns rows startIndex (inclusive) to endIndex (exclusive) as a board of their own. the rows are shared, not copied
+func (b BitBoard) Slice(startIndex, endIndex int) BitBoard {
+	return b.WithRowsFrom(startIndex, b.Rows[startIndex:endIndex])
+}
+
+// Copy returns a copy of the board that shares nothing with it
+func (b BitBoard) Copy() BitBoard {
+	rows := make([][]uint64, len(b.Rows))
+	for i, row := range b.Rows {
+		rows[i] = make([]uint64, len(row))
+		copy(rows[i], row)
+	}
+	return b.WithRows(rows)
+}
@@ -0,0 +1,92 @@
+package util
+
+import "fmt"
+
+// Boundary says what a cell on the edge of the world has as its neighbours past the edge
+type Boundary int
+
+const (
+	// Torus wraps around from top to bottom and from side to side
+	Torus Boundary = iota
+	// Dead has nothing past the edges, so those neighbours are always dead
+	Dead
+	// Klein wraps around from side to side like a torus, but the top and bottom are joined with a twist,
+	// so the row above the top row is the bottom row flipped left to right
+	Klein
+	// Mirror reflects the world in each edge, so the neighbours past an edge are the cells on it and the ones next to them
+	Mirror
+)
+
+var boundaryNames = []string{"torus", "dead", "klein", "mirror"}
+
+// ParseBoundary reads a boundary by name: torus, dead, klein or mirror. the empty string is Torus
+func ParseBoundary(boundary string) (Boundary, error) {
+	if boundary == "" {
+		return Torus, nil
+	}
+	for b, name := range boundaryNames {
+		if boundary == name {
+			return Boundary(b), nil
+		}
+	}
+	return Torus, fmt.Errorf("unknown boundary %q, expected torus, dead, klein or mirror", boundary)
+}
+
+func (b Boundary) String() string {
+	return boundaryNames[b]
+}
+
+// Index maps a row or column index i, which can be past either edge of a world size cells across, back into the world.
+// flipped is true when the other axis is flipped over as well (only across the top and bottom of a Klein bottle),
+// and ok is false when i is past a Dead edge
+func (b Boundary) Index(i, size int, vertical bool) (index int, flipped bool, ok bool) {
+	switch b {
+	case Dead:
+		return i, false, i >= 0 && i < size
+	case Mirror:
+		//reflecting in both edges repeats every two worlds
+		i = ((i % (2 * size)) + 2*size) % (2 * size)
+		if i >= size {
+			i = 2*size - 1 - i
+		}
+		return i, false, true
+	case Klein:
+		if vertical {
+			//every time the world is wrapped around, it is flipped over
+			wraps := i / size
+			if i < 0 {
+				wraps = (i+1)/size - 1
+			}
+			return ((i % size) + size) % size, wraps%2 != 0, true
+		}
+	}
+	return ((i % size) + size) % size, false, true
+}
+
+// RowAt returns row i of the board, where i can be past the top or bottom edge. rows past a Dead edge are nil,
+// and rows across the top or bottom of a Klein bottle are flipped copies
+func (b BitBoard) RowAt(i int, boundary Boundary) []uint64 {
+	index, flipped, ok := boundary.Index(i, b.Height, true)
+	if !ok {
+		return nil
+	}
+	if flipped {
+		return FlipRow(b.Rows[index], b.Width)
+	}
+	return b.Rows[index]
+}
+
+// FlipRow returns a copy of a packed row flipped left to right, plane by plane
+func FlipRow(row []uint64, width int) []uint64 {
+	words := WordsPerRow(width)
+	flipped := make([]uint64, len(row))
+	for p := 0; p < len(row); p += words {
+		for x := 0; x < width; x++ {
+			if row[p+x/64]>>uint(x%64)&1 == 1 {
+				y := width - 1 - x
+				flipped[p+y/64] |= 1 << uint(y%64)
+			}
+		}
+	}
+	return flipped
+}
@@ -0,0 +1,175 @@
+package util
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// EngineVersion is the version of the engine that wrote a checkpoint. it goes up whenever a change means the turns after a checkpoint
+// would come out differently, or the checkpoint would be read differently, so checkpoints from other versions aren't resumed from
+const EngineVersion = 1
+
+// checkpointMagic is the first line of a checkpoint
+const checkpointMagic = "GOL checkpoint"
+
+// Checkpoint is a world along with what it takes to carry on from it: the Turn it is on, the Rule (with its neighbourhood) and Boundary
+// it was run with, and the Engine and EngineVersion that ran it. Turns and TurnsPerBatch are the turn the run ends on and the size of its batches,
+// which are 0 if they weren't written. World is the cells as grey levels (see Grey), and its sha256 is written with it
+type Checkpoint struct {
+	Version       int
+	Engine        string
+	Width         int
+	Height        int
+	Turn          int
+	Turns         int
+	TurnsPerBatch int
+	Rule          string
+	Boundary      string
+	World         [][]byte
+}
+
+// WriteCheckpoint writes a checkpoint. the header is the line GOL checkpoint, then a key and value on each line, and ends with an empty line.
+// the cells follow it as grey levels, a byte each, row by row. it is written to a temporary file first, then renamed,
+// so a run that stops part way through writing one never leaves a broken checkpoint behind
+func WriteCheckpoint(path string, cp Checkpoint) error {
+	file, err := os.Create(path + ".tmp")
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	writer := bufio.NewWriter(file)
+
+	hash := sha256.New()
+	for _, row := range cp.World {
+		hash.Write(row)
+	}
+	fmt.Fprintln(writer, checkpointMagic)
+	fmt.Fprintln(writer, "version", cp.Version)
+	fmt.Fprintln(writer, "engine", cp.Engine)
+	fmt.Fprintln(writer, "width", cp.Width)
+	fmt.Fprintln(writer, "height", cp.Height)
+	fmt.Fprintln(writer, "turn", cp.Turn)
+	fmt.Fprintln(writer, "turns", cp.Turns)
+	fmt.Fprintln(writer, "batch", cp.TurnsPerBatch)
+	fmt.Fprintln(writer, "rule", cp.Rule)
+	fmt.Fprintln(writer, "boundary", cp.Boundary)
+	fmt.Fprintln(writer, "sha256", hex.EncodeToString(hash.Sum(nil)))
+	fmt.Fprintln(writer)
+	for _, row := range cp.World {
+		if _, err := writer.Write(row); err != nil {
+			return err
+		}
+	}
+
+	if err := writer.Flush(); err != nil {
+		return err
+	}
+	if err := file.Sync(); err != nil {
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	return os.Rename(path+".tmp", path)
+}
+
+// ReadCheckpoint reads a checkpoint, making sure it has every key in its header, other than turns and batch, and that its cells match their sha256
+func ReadCheckpoint(path string) (Checkpoint, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return Checkpoint{}, err
+	}
+	defer file.Close()
+	reader := bufio.NewReader(file)
+
+	line, err := reader.ReadString('\n')
+	if err != nil || strings.TrimSpace(line) != checkpointMagic {
+		return Checkpoint{}, fmt.Errorf("%v is not a checkpoint, which starts with %v", path, checkpointMagic)
+	}
+	//the number of bytes up to the end of the header
+	headerSize := int64(len(line))
+	var cp Checkpoint
+	fields := make(map[string]string)
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return Checkpoint{}, fmt.Errorf("%v ends before the end of its header", path)
+		}
+		headerSize += int64(len(line))
+		line = strings.TrimSpace(line)
+		if line == "" {
+			break
+		}
+		keyValue := strings.SplitN(line, " ", 2)
+		if len(keyValue) == 1 {
+			keyValue = append(keyValue, "")
+		}
+		fields[keyValue[0]] = keyValue[1]
+	}
+	for _, field := range []struct {
+		name     string
+		value    *int
+		min      int
+		optional bool
+	}{
+		{"version", &cp.Version, 1, false}, {"width", &cp.Width, 1, false}, {"height", &cp.Height, 1, false}, {"turn", &cp.Turn, 0, false},
+		{"turns", &cp.Turns, 0, true}, {"batch", &cp.TurnsPerBatch, 0, true},
+	} {
+		value, ok := fields[field.name]
+		if !ok && field.optional {
+			continue
+		}
+		if !ok {
+			return Checkpoint{}, fmt.Errorf("%v has no %v in its header", path, field.name)
+		}
+		if *field.value, err = strconv.Atoi(value); err != nil || *field.value < field.min {
+			return Checkpoint{}, fmt.Errorf("%v has a %v of %q, which has to be a number from %d", path, field.name, value, field.min)
+		}
+	}
+	for _, field := range []struct {
+		name  string
+		value *string
+	}{{"engine", &cp.Engine}, {"rule", &cp.Rule}, {"boundary", &cp.Boundary}} {
+		value, ok := fields[field.name]
+		if !ok {
+			return Checkpoint{}, fmt.Errorf("%v has no %v in its header", path, field.name)
+		}
+		*field.value = value
+	}
+	sha, ok := fields["sha256"]
+	if !ok {
+		return Checkpoint{}, fmt.Errorf("%v has no sha256 in its header", path)
+	}
+
+	//the size in the header is checked against what is left of the file before the world is made, so a damaged header can't ask for too much
+	info, err := file.Stat()
+	if err != nil {
+		return Checkpoint{}, err
+	}
+	if cells := info.Size() - headerSize; int64(cp.Height) > cells/int64(cp.Width) {
+		return Checkpoint{}, fmt.Errorf("%v is %dx%d, but only has %d bytes of cells", path, cp.Width, cp.Height, cells)
+	}
+
+	hash := sha256.New()
+	cp.World = make([][]byte, cp.Height)
+	for y := range cp.World {
+		cp.World[y] = make([]byte, cp.Width)
+		if _, err := io.ReadFull(reader, cp.World[y]); err != nil {
+			return Checkpoint{}, fmt.Errorf("%v is %dx%d, but ends after %d of its rows", path, cp.Width, cp.Height, y)
+		}
+		hash.Write(cp.World[y])
+	}
+	if _, err := reader.ReadByte(); err != io.EOF {
+		return Checkpoint{}, fmt.Errorf("%v goes on past the %dx%d cells its header says", path, cp.Width, cp.Height)
+	}
+	if sum := hex.EncodeToString(hash.Sum(nil)); sum != sha {
+		return Checkpoint{}, fmt.Errorf("%v has been damaged or changed, as its cells have a sha256 of %v, not the %v in its header", path, sum, sha)
+	}
+	return cp, nil
+}
@@ -9,6 +9,37 @@ func VisualiseMatrix(given [][]uint8, width, height int) {
 	fmt.Print(matricesToString(given, nil, width, height))
 }
 
+// VisualiseHexMatrix is VisualiseMatrix for a hexagonal grid, with every odd row shifted half a cell to the east
+func VisualiseHexMatrix(given [][]uint8, width, height int) {
+	fmt.Print(hexToString(given, width, height))
+}
+
+func hexToString(given [][]uint8, width, height int) string {
+	var output []string
+	output = append(output, "  Your world matrix:\n")
+	output = append(output, getHorizontalBorder("  ┌", "─", "─┐\n", width))
+	for i := 0; i < height; i++ {
+		output = append(output, fmt.Sprintf("%2d│", i))
+		//a cell is two characters wide, so half a cell is one
+		if i%2 == 1 {
+			output = append(output, " ")
+		}
+		for j := 0; j < width; j++ {
+			if given[i][j] == 0xFF {
+				output = append(output, "██")
+			} else {
+				output = append(output, "  ")
+			}
+		}
+		if i%2 == 0 {
+			output = append(output, " ")
+		}
+		output = append(output, "│\n")
+	}
+	output = append(output, getHorizontalBorder("  └", "─", "─┘\n", width))
+	return strings.Join(output, "")
+}
+
 func (c1 Cell) in(slice []Cell) bool {
 	for _, c2 := range slice {
 		if c1 == c2 {